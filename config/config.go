@@ -1,9 +1,16 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 type Config struct {
 	Yuque        *YuqueConfig
 	Confluence   *ConfluenceConfig
 	Notification *NotificationConfig
+	Repos        map[string]*RepoConfig
 }
 
 type YuqueConfig struct {
@@ -18,8 +25,416 @@ type ConfluenceConfig struct {
 	Domain string `json:"domain"`
 	Space  string `json:"space"`
 	Auth   string `json:"auth"`
+	// 语雀用户login到Confluence用户名的映射，以group:开头表示用户组，未配置的用户使用相同的用户名
+	UserMapping map[string]string `json:"user_mapping"`
 }
 
 type NotificationConfig struct {
 	Url string `json:"url"`
 }
+
+// RepoConfig 按语雀知识库标题配置，未配置的知识库使用默认值
+type RepoConfig struct {
+	// 知识库首页的目录宏，可选 children、pagetree，为空时不生成目录
+	HomeToc string `json:"home_toc"`
+	// 作为知识库首页的文档slug，为空时依次查找index、homepage
+	HomeSlug string `json:"home_slug"`
+	// 草稿和私密文档的同步策略，可选 skip、restrict、sync，默认skip
+	DraftPolicy   string `json:"draft_policy"`
+	PrivatePolicy string `json:"private_policy"`
+	// restrict策略下仅以下用户和用户组可以查看、编辑页面，私密知识库的根页面也总是包含这些用户和用户组
+	RestrictUsers  []string `json:"restrict_users"`
+	RestrictGroups []string `json:"restrict_groups"`
+	// 公开知识库默认不修改根页面的限制，开启后清除根页面上的限制
+	ClearPublicRestrictions bool `json:"clear_public_restrictions"`
+	// 页面顶部的语雀来源说明
+	Attribution *AttributionConfig `json:"attribution"`
+	// 语雀文件卡片中的附件
+	Attachment *AttachmentConfig `json:"attachment"`
+	// 页面不再引用的同步附件的处理方式，可选 off、archive（移入回收站）、delete（彻底删除），默认archive
+	AttachmentGc string `json:"attachment_gc"`
+	// 语雀标签到Confluence标签的映射，映射为空字符串时忽略该标签
+	LabelMapping map[string]string `json:"label_mapping"`
+	// 将语雀文档评论同步为页面底部评论
+	MirrorComments bool `json:"mirror_comments"`
+	// 新建页面时按顺序回放语雀历史版本，用于迁移
+	ReplayHistory bool `json:"replay_history"`
+	// 语雀表格没有表头标记，开启后将第一行转换为表头
+	TableHeaderRow bool `json:"table_header_row"`
+	// 语雀代码块语言到Confluence代码宏语言的映射，覆盖默认映射
+	CodeLanguages map[string]string `json:"code_languages"`
+	// 语雀公式的转换方式
+	Math *MathConfig `json:"math"`
+	// 文本绘图类型（plantuml、mermaid、graphviz）到Confluence宏名称的映射，未配置时上传渲染后的图片
+	DiagramMacros map[string]string `json:"diagram_macros"`
+	// widget宏支持的嵌入内容域名，覆盖默认值
+	WidgetHosts []string `json:"widget_hosts"`
+	// 文档目录宏，可选 toc、easy-heading-free、none，默认easy-heading-free
+	Toc string `json:"toc"`
+	// 转换规则的启用、禁用、执行顺序和自定义规则
+	Rules *RulesConfig `json:"rules"`
+	// 正文来源，html 使用语雀渲染的body_html，lake 解析语雀原生格式，markdown 解析markdown文档原文，
+	// lake和markdown无法转换时回退到html
+	Converter string `json:"converter"`
+	// 页面内容未通过存储格式校验时，使用纯文本内容更新该页面，而不是中止同步
+	StorageFallback bool `json:"storage_fallback"`
+}
+
+type RulesConfig struct {
+	// 规则执行顺序，为空时使用默认顺序，不在列表中的规则按默认顺序在之后执行，不执行的规则使用disable关闭
+	Order   []string            `json:"order"`
+	Enable  []string            `json:"enable"`
+	Disable []string            `json:"disable"`
+	Custom  []*CustomRuleConfig `json:"custom"`
+}
+
+type CustomRuleConfig struct {
+	Name     string `json:"name"`
+	Selector string `json:"selector"`
+	// 可选 replace、remove、unwrap、regexp
+	Action string `json:"action"`
+	// regexp方式下对节点内部html进行替换的正则表达式
+	Pattern string `json:"pattern"`
+	// replace方式下替换节点的html，regexp方式下的替换内容，支持$1形式的分组引用
+	Replacement string `json:"replacement"`
+}
+
+type AttributionConfig struct {
+	Disable bool   `json:"disable"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+type AttachmentConfig struct {
+	// 单个附件大小上限，单位字节
+	MaxSize int64 `json:"max_size"`
+	// 允许上传的MIME类型，支持 application/vnd.ms-* 形式的前缀匹配
+	MimeTypes []string `json:"mime_types"`
+	// 附件展示方式，可选 link、view-file，默认link
+	Macro string `json:"macro"`
+}
+
+type MathConfig struct {
+	// 可选 macro、png、code，默认code
+	Target string `json:"target"`
+	// macro方式使用的宏名称，默认mathinline
+	Macro string `json:"macro"`
+	// macro方式下公式源码所在的宏参数，为空时放在宏的正文中
+	Param string `json:"param"`
+	// png方式的公式渲染地址，%s替换为转义后的公式源码，公式会发送到该地址，没有默认值，使用png方式时必须配置
+	PngUrl string `json:"png_url"`
+}
+
+const (
+	HomeTocChildren = "children"
+	HomeTocPageTree = "pagetree"
+)
+
+const (
+	DocPolicySkip     = "skip"
+	DocPolicyRestrict = "restrict"
+	DocPolicySync     = "sync"
+)
+
+const (
+	AttachmentMacroLink     = "link"
+	AttachmentMacroViewFile = "view-file"
+)
+
+const (
+	AttachmentGcOff     = "off"
+	AttachmentGcArchive = "archive"
+	AttachmentGcDelete  = "delete"
+)
+
+const (
+	MathTargetMacro = "macro"
+	MathTargetPng   = "png"
+	MathTargetCode  = "code"
+)
+
+const (
+	TocMacroToc         = "toc"
+	TocMacroEasyHeading = "easy-heading-free"
+	TocMacroNone        = "none"
+)
+
+const (
+	ConverterHtml     = "html"
+	ConverterLake     = "lake"
+	ConverterMarkdown = "markdown"
+)
+
+const (
+	CustomRuleReplace = "replace"
+	CustomRuleRemove  = "remove"
+	CustomRuleUnwrap  = "unwrap"
+	CustomRuleRegexp  = "regexp"
+)
+
+var defaultHomeSlugs = []string{"index", "homepage"}
+
+var defaultAttribution = &AttributionConfig{
+	Title:   "本页面由语雀同步生成",
+	Message: "请勿在 Confluence 中直接编辑，修改请前往语雀原文",
+}
+
+var defaultAttachment = &AttachmentConfig{
+	MaxSize: 50 * 1024 * 1024,
+	MimeTypes: []string{
+		"application/pdf",
+		"application/zip",
+		"application/x-zip-compressed",
+		"application/x-rar-compressed",
+		"application/x-7z-compressed",
+		"application/gzip",
+		"application/msword",
+		"application/vnd.ms-*",
+		"application/vnd.openxmlformats-officedocument.*",
+		"text/plain",
+		"text/csv",
+	},
+	Macro: AttachmentMacroLink,
+}
+
+// Confluence代码宏支持的语言
+var codeLanguages = map[string]bool{
+	"actionscript3": true, "applescript": true, "bash": true, "c#": true, "cpp": true, "css": true,
+	"coldfusion": true, "delphi": true, "diff": true, "erl": true, "groovy": true, "xml": true,
+	"java": true, "jfx": true, "js": true, "php": true, "perl": true, "text": true, "powershell": true,
+	"py": true, "ruby": true, "sql": true, "sass": true, "scala": true, "vb": true, "yml": true, "go": true,
+}
+
+var defaultCodeLanguages = map[string]string{
+	"golang":     "go",
+	"shell":      "bash",
+	"sh":         "bash",
+	"zsh":        "bash",
+	"javascript": "js",
+	"jsx":        "js",
+	"typescript": "js",
+	"ts":         "js",
+	"json":       "js",
+	"python":     "py",
+	"yaml":       "yml",
+	"html":       "xml",
+	"c":          "cpp",
+	"c++":        "cpp",
+	"csharp":     "c#",
+	"erlang":     "erl",
+	"plain":      "text",
+	"plaintext":  "text",
+	"scss":       "sass",
+	"ps1":        "powershell",
+}
+
+var defaultMath = &MathConfig{
+	Target: MathTargetCode,
+	Macro:  "mathinline",
+	Param:  "body",
+}
+
+var defaultWidgetHosts = []string{
+	"youtube.com",
+	"youtu.be",
+	"vimeo.com",
+	"dailymotion.com",
+	"slideshare.net",
+	"twitter.com",
+	"bilibili.com",
+	"figma.com",
+}
+
+func (c *Config) RepoConfig(title string) *RepoConfig {
+	if repoConfig, exist := c.Repos[title]; exist && repoConfig != nil {
+		return repoConfig
+	}
+	return &RepoConfig{}
+}
+
+func (c *RepoConfig) HomeSlugs() []string {
+	if c.HomeSlug != "" {
+		return []string{c.HomeSlug}
+	}
+	return defaultHomeSlugs
+}
+
+func (c *RepoConfig) AttributionPanel() *AttributionConfig {
+	if c.Attribution == nil {
+		return defaultAttribution
+	}
+	attribution := *c.Attribution
+	if attribution.Title == "" {
+		attribution.Title = defaultAttribution.Title
+	}
+	if attribution.Message == "" {
+		attribution.Message = defaultAttribution.Message
+	}
+	return &attribution
+}
+
+func (c *RepoConfig) AttachmentRule() *AttachmentConfig {
+	attachment := AttachmentConfig{}
+	if c.Attachment != nil {
+		attachment = *c.Attachment
+	}
+	if attachment.MaxSize == 0 {
+		attachment.MaxSize = defaultAttachment.MaxSize
+	}
+	if len(attachment.MimeTypes) == 0 {
+		attachment.MimeTypes = defaultAttachment.MimeTypes
+	}
+	if attachment.Macro == "" {
+		attachment.Macro = defaultAttachment.Macro
+	}
+	return &attachment
+}
+
+func (c *RepoConfig) AttachmentGcMode() string {
+	if c.AttachmentGc == "" {
+		return AttachmentGcArchive
+	}
+	return c.AttachmentGc
+}
+
+func (c *RepoConfig) MathRule() *MathConfig {
+	if c.Math == nil {
+		return defaultMath
+	}
+	math := *c.Math
+	if math.Target == "" {
+		math.Target = defaultMath.Target
+	}
+	// 只补充未配置的字段，自定义宏时参数为空表示放在宏的正文中
+	if math.Macro == "" {
+		math.Macro = defaultMath.Macro
+		if math.Param == "" {
+			math.Param = defaultMath.Param
+		}
+	}
+	return &math
+}
+
+func (c *RepoConfig) TocMacro() string {
+	if c.Toc == "" {
+		return TocMacroEasyHeading
+	}
+	return c.Toc
+}
+
+func (c *RepoConfig) DocConverter() string {
+	if c.Converter == "" {
+		return ConverterHtml
+	}
+	return c.Converter
+}
+
+func (c *RepoConfig) DraftDocPolicy() string {
+	if c.DraftPolicy == "" {
+		return DocPolicySkip
+	}
+	return c.DraftPolicy
+}
+
+func (c *RepoConfig) PrivateDocPolicy() string {
+	if c.PrivatePolicy == "" {
+		return DocPolicySkip
+	}
+	return c.PrivatePolicy
+}
+
+func (c *RepoConfig) Validate() error {
+	for _, policy := range []string{c.DraftDocPolicy(), c.PrivateDocPolicy()} {
+		switch policy {
+		case DocPolicySkip, DocPolicySync:
+		case DocPolicyRestrict:
+			if len(c.RestrictUsers) == 0 && len(c.RestrictGroups) == 0 {
+				return errors.New("restrict policy requires restrict_users or restrict_groups")
+			}
+		default:
+			return errors.New(fmt.Sprintf("unknown doc policy %v", policy))
+		}
+	}
+	if macro := c.AttachmentRule().Macro; macro != AttachmentMacroLink && macro != AttachmentMacroViewFile {
+		return errors.New(fmt.Sprintf("unknown attachment macro %v", macro))
+	}
+	switch target := c.MathRule().Target; target {
+	case MathTargetMacro, MathTargetCode:
+	case MathTargetPng:
+		if !strings.Contains(c.MathRule().PngUrl, "%s") {
+			return errors.New("math target png requires png_url containing %s")
+		}
+	default:
+		return errors.New(fmt.Sprintf("unknown math target %v", target))
+	}
+	switch toc := c.TocMacro(); toc {
+	case TocMacroToc, TocMacroEasyHeading, TocMacroNone:
+	default:
+		return errors.New(fmt.Sprintf("unknown toc macro %v", toc))
+	}
+	switch mode := c.AttachmentGcMode(); mode {
+	case AttachmentGcOff, AttachmentGcArchive, AttachmentGcDelete:
+	default:
+		return errors.New(fmt.Sprintf("unknown attachment gc mode %v", mode))
+	}
+	switch converter := c.DocConverter(); converter {
+	case ConverterHtml, ConverterLake, ConverterMarkdown:
+	default:
+		return errors.New(fmt.Sprintf("unknown converter %v", converter))
+	}
+	return nil
+}
+
+func (c *AttachmentConfig) AllowMimeType(mimeType string) bool {
+	for _, t := range c.MimeTypes {
+		if strings.HasSuffix(t, "*") && strings.HasPrefix(mimeType, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+		if t == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+const groupPrefix = "group:"
+
+// MapUser 返回语雀用户对应的Confluence用户名或用户组
+func (c *ConfluenceConfig) MapUser(login string) (user string, group string) {
+	mapped, exist := c.UserMapping[login]
+	if !exist {
+		return login, ""
+	}
+	if strings.HasPrefix(mapped, groupPrefix) {
+		return "", strings.TrimPrefix(mapped, groupPrefix)
+	}
+	return mapped, ""
+}
+
+// CodeLanguage 返回Confluence代码宏的语言，无法识别时返回空
+func (c *RepoConfig) CodeLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if mapped, exist := c.CodeLanguages[language]; exist {
+		return mapped
+	}
+	if mapped, exist := defaultCodeLanguages[language]; exist {
+		return mapped
+	}
+	if codeLanguages[language] {
+		return language
+	}
+	return ""
+}
+
+func (c *RepoConfig) IsWidgetHost(host string) bool {
+	hosts := c.WidgetHosts
+	if len(hosts) == 0 {
+		hosts = defaultWidgetHosts
+	}
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
@@ -5,5 +5,6 @@ go 1.16
 require (
 	github.com/PuerkitoBio/goquery v1.8.0
 	github.com/google/uuid v1.3.0
+	github.com/yuin/goldmark v1.4.13
 	golang.org/x/net v0.0.0-20210916014120-12bc252f5db8
 )
@@ -50,7 +50,7 @@ func (a *Api) getDocList(start uint64, limit uint64) ([]*DocDetail, error) {
 	}
 	params := map[string]string{
 		"spaceKey": a.space,
-		"expand":   "version,ancestors",
+		"expand":   "version,ancestors,metadata.labels,metadata.properties." + syncedRestrictionsProperty,
 		"start":    strconv.FormatUint(start, 10),
 		"limit":    strconv.FormatUint(limit, 10),
 	}
@@ -70,6 +70,14 @@ func (a *Api) getDocList(start uint64, limit uint64) ([]*DocDetail, error) {
 			Ancestors []struct {
 				Id string `json:"id"`
 			}
+			Metadata struct {
+				Labels struct {
+					Results []labelDetail `json:"results"`
+				} `json:"labels"`
+				Properties map[string]struct {
+					Value json.RawMessage `json:"value"`
+				} `json:"properties"`
+			} `json:"metadata"`
 		}
 	}
 	if err := json.Unmarshal(respBody, &respData); err != nil {
@@ -94,6 +102,14 @@ func (a *Api) getDocList(start uint64, limit uint64) ([]*DocDetail, error) {
 			})
 		}
 		doc.Ancestors = ancestors
+		labels := make([]string, 0, len(result.Metadata.Labels.Results))
+		for _, l := range result.Metadata.Labels.Results {
+			labels = append(labels, l.Name)
+		}
+		doc.Labels = labels
+		if property, exist := result.Metadata.Properties[syncedRestrictionsProperty]; exist {
+			_ = json.Unmarshal(property.Value, &doc.Restricted)
+		}
 		docs = append(docs, doc)
 	}
 
@@ -169,7 +185,7 @@ func (a *Api) createDoc(docTitle string, docAncestors []AncestorDetail, docBody
 	return doc, nil
 }
 
-func (a *Api) updateDoc(docId string, docTitle string, docVersion float64, docBody string) (*DocDetail, error) {
+func (a *Api) updateDoc(docId string, docTitle string, docVersion float64, docBody string, docMessage string) (*DocDetail, error) {
 	url := a.domain + "/rest/api/content/" + docId
 	options := map[string]string{
 		"Authorization": a.auth,
@@ -191,7 +207,8 @@ func (a *Api) updateDoc(docId string, docTitle string, docVersion float64, docBo
 		Body    bodyDetail    `json:"body"`
 	}{
 		Version: versionDetail{
-			Number: docVersion,
+			Number:  docVersion,
+			Message: docMessage,
 		},
 		Type:  "page",
 		Title: docTitle,
@@ -241,6 +258,110 @@ func (a *Api) updateDoc(docId string, docTitle string, docVersion float64, docBo
 	return doc, nil
 }
 
+func (a *Api) createComment(docId string, parentId string, commentBody string) (string, error) {
+	url := a.domain + "/rest/api/content/"
+	options := map[string]string{
+		"Authorization": a.auth,
+		"Content-Type":  "application/json",
+	}
+	req := struct {
+		Type      string           `json:"type"`
+		Container containerDetail  `json:"container"`
+		Ancestors []AncestorDetail `json:"ancestors,omitempty"`
+		Body      bodyDetail       `json:"body"`
+	}{
+		Type: "comment",
+		Container: containerDetail{
+			Id:   docId,
+			Type: "page",
+		},
+		Body: bodyDetail{
+			Storage: storageDetail{
+				Value:          commentBody,
+				Representation: "storage",
+			},
+		},
+	}
+	if parentId != "" {
+		req.Ancestors = []AncestorDetail{{Id: parentId}}
+	}
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	respBody, err := httputil.Post(url, options, nil, reqBytes)
+	if err != nil {
+		return "", err
+	}
+
+	var respData struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return "", err
+	}
+
+	return respData.Id, nil
+}
+
+func (a *Api) getCommentListFull(docId string) ([]*CommentDetail, error) {
+	commentList := make([]*CommentDetail, 0)
+	start := uint64(0)
+	limit := uint64(100)
+
+	for {
+		comments, err := a.getCommentList(docId, start, limit)
+		if err != nil {
+			return nil, err
+		}
+		commentList = append(commentList, comments...)
+		start += limit
+
+		if uint64(len(comments)) < limit {
+			break
+		}
+	}
+
+	return commentList, nil
+}
+
+func (a *Api) getCommentList(docId string, start uint64, limit uint64) ([]*CommentDetail, error) {
+	url := a.domain + "/rest/api/content/" + docId + "/child/comment"
+	options := map[string]string{
+		"Authorization": a.auth,
+	}
+	params := map[string]string{
+		"expand": "body.storage",
+		"depth":  "all",
+		"start":  strconv.FormatUint(start, 10),
+		"limit":  strconv.FormatUint(limit, 10),
+	}
+	respBody, err := httputil.Get(url, options, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respData struct {
+		Results []struct {
+			Id   string     `json:"id"`
+			Body bodyDetail `json:"body"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return nil, err
+	}
+
+	comments := make([]*CommentDetail, 0, len(respData.Results))
+	for _, r := range respData.Results {
+		comments = append(comments, &CommentDetail{
+			Id:   r.Id,
+			Body: r.Body.Storage.Value,
+		})
+	}
+
+	return comments, nil
+}
+
 func (a *Api) createAttachment(body []byte, docID string, contentType string) error {
 	url := a.domain + "/rest/api/content/" + docID + "/child/attachment"
 	options := map[string]string{
@@ -336,6 +457,371 @@ func (a *Api) getDocBrief(docId string) (*DocBrief, error) {
 	}, nil
 }
 
+func (a *Api) getCurrentUser() (string, error) {
+	url := a.domain + "/rest/api/user/current"
+	options := map[string]string{
+		"Authorization": a.auth,
+	}
+	respBody, err := httputil.Get(url, options, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var respData struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return "", err
+	}
+
+	return respData.Username, nil
+}
+
+func (a *Api) getDocRestrictions(docId string) ([]RestrictionDetail, error) {
+	url := a.domain + "/rest/api/content/" + docId + "/restriction/byOperation"
+	options := map[string]string{
+		"Authorization": a.auth,
+	}
+	params := map[string]string{
+		"expand": "read.restrictions.user,read.restrictions.group,update.restrictions.user,update.restrictions.group",
+	}
+	respBody, err := httputil.Get(url, options, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respData map[string]struct {
+		Restrictions struct {
+			User struct {
+				Results []struct {
+					Username string `json:"username"`
+				} `json:"results"`
+			} `json:"user"`
+			Group struct {
+				Results []struct {
+					Name string `json:"name"`
+				} `json:"results"`
+			} `json:"group"`
+		} `json:"restrictions"`
+	}
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return nil, err
+	}
+
+	restrictions := make([]RestrictionDetail, 0, len(respData))
+	for _, operation := range []string{RestrictionRead, RestrictionUpdate} {
+		r := RestrictionDetail{
+			Operation: operation,
+			Users:     make([]string, 0),
+			Groups:    make([]string, 0),
+		}
+		for _, u := range respData[operation].Restrictions.User.Results {
+			r.Users = append(r.Users, u.Username)
+		}
+		for _, g := range respData[operation].Restrictions.Group.Results {
+			r.Groups = append(r.Groups, g.Name)
+		}
+		restrictions = append(restrictions, r)
+	}
+
+	return restrictions, nil
+}
+
+func (a *Api) updateDocRestrictions(docId string, restrictions []RestrictionDetail) error {
+	url := a.domain + "/rest/api/content/" + docId + "/restriction"
+	options := map[string]string{
+		"Authorization": a.auth,
+		"Content-Type":  "application/json",
+	}
+
+	type userDetail struct {
+		Type     string `json:"type"`
+		Username string `json:"username"`
+	}
+	type groupDetail struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	type restrictionsDetail struct {
+		User  []userDetail  `json:"user"`
+		Group []groupDetail `json:"group"`
+	}
+	req := make([]struct {
+		Operation    string             `json:"operation"`
+		Restrictions restrictionsDetail `json:"restrictions"`
+	}, len(restrictions))
+	for i, r := range restrictions {
+		req[i].Operation = r.Operation
+		req[i].Restrictions.User = make([]userDetail, 0, len(r.Users))
+		for _, u := range r.Users {
+			req[i].Restrictions.User = append(req[i].Restrictions.User, userDetail{Type: "known", Username: u})
+		}
+		req[i].Restrictions.Group = make([]groupDetail, 0, len(r.Groups))
+		for _, g := range r.Groups {
+			req[i].Restrictions.Group = append(req[i].Restrictions.Group, groupDetail{Type: "group", Name: g})
+		}
+	}
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, err := httputil.Put(url, options, nil, reqBytes); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a *Api) updateAttachmentData(body []byte, docID string, attachmentId string, contentType string) error {
+	url := a.domain + "/rest/api/content/" + docID + "/child/attachment/" + attachmentId + "/data"
+	options := map[string]string{
+		"Authorization":     a.auth,
+		"Content-Type":      contentType,
+		"X-Atlassian-Token": "no-check",
+	}
+	_, err := httputil.Post(url, options, nil, body)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a *Api) getAttachmentListFull(docId string) ([]*FileDetail, error) {
+	fileList := make([]*FileDetail, 0)
+	start := uint64(0)
+	limit := uint64(100)
+
+	for {
+		files, err := a.getAttachmentList(docId, start, limit)
+		if err != nil {
+			return nil, err
+		}
+		fileList = append(fileList, files...)
+		start += limit
+
+		if uint64(len(files)) < limit {
+			break
+		}
+	}
+
+	return fileList, nil
+}
+
+func (a *Api) getAttachmentList(docId string, start uint64, limit uint64) ([]*FileDetail, error) {
+	url := a.domain + "/rest/api/content/" + docId + "/child/attachment"
+	options := map[string]string{
+		"Authorization": a.auth,
+	}
+	params := map[string]string{
+		"expand": "version,metadata",
+		"start":  strconv.FormatUint(start, 10),
+		"limit":  strconv.FormatUint(limit, 10),
+	}
+	respBody, err := httputil.Get(url, options, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respData struct {
+		Results []struct {
+			Id      string `json:"id"`
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Title   string `json:"title"`
+			Version struct {
+				Number float64 `json:"number"`
+			} `json:"version"`
+			Metadata struct {
+				Comment string `json:"comment"`
+			} `json:"metadata"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return nil, err
+	}
+
+	files := make([]*FileDetail, 0, len(respData.Results))
+	for _, result := range respData.Results {
+		files = append(files, &FileDetail{
+			Id:      result.Id,
+			Status:  result.Status,
+			Type:    result.Type,
+			Title:   result.Title,
+			Version: result.Version.Number,
+			Comment: result.Metadata.Comment,
+		})
+	}
+
+	return files, nil
+}
+
+func (a *Api) deleteAttachment(attachmentId string, purge bool) error {
+	// 删除后附件进入回收站，purge时再从回收站彻底删除
+	if err := a.deleteDoc(attachmentId); err != nil {
+		return err
+	}
+	if !purge {
+		return nil
+	}
+
+	url := a.domain + "/rest/api/content/" + attachmentId
+	options := map[string]string{
+		"Authorization": a.auth,
+	}
+	params := map[string]string{
+		"status": "trashed",
+	}
+	if _, err := httputil.Delete(url, options, params); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a *Api) getDocLabels(docId string) ([]string, error) {
+	url := a.domain + "/rest/api/content/" + docId + "/label"
+	options := map[string]string{
+		"Authorization": a.auth,
+	}
+	params := map[string]string{
+		"limit": "200",
+	}
+	respBody, err := httputil.Get(url, options, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respData struct {
+		Results []labelDetail `json:"results"`
+	}
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return nil, err
+	}
+
+	labels := make([]string, 0, len(respData.Results))
+	for _, r := range respData.Results {
+		labels = append(labels, r.Name)
+	}
+
+	return labels, nil
+}
+
+func (a *Api) addDocLabels(docId string, labels []string) error {
+	url := a.domain + "/rest/api/content/" + docId + "/label"
+	options := map[string]string{
+		"Authorization": a.auth,
+		"Content-Type":  "application/json",
+	}
+	req := make([]labelDetail, 0, len(labels))
+	for _, l := range labels {
+		req = append(req, labelDetail{
+			Prefix: "global",
+			Name:   l,
+		})
+	}
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, err := httputil.Post(url, options, nil, reqBytes); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a *Api) deleteDocLabel(docId string, label string) error {
+	url := a.domain + "/rest/api/content/" + docId + "/label"
+	options := map[string]string{
+		"Authorization": a.auth,
+	}
+	params := map[string]string{
+		"name": label,
+	}
+	if _, err := httputil.Delete(url, options, params); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (a *Api) getDocProperty(docId string, key string) (*PropertyDetail, error) {
+	url := a.domain + "/rest/api/content/" + docId + "/property"
+	options := map[string]string{
+		"Authorization": a.auth,
+	}
+	params := map[string]string{
+		"expand": "version",
+		"limit":  "100",
+	}
+	respBody, err := httputil.Get(url, options, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respData struct {
+		Results []struct {
+			Key     string          `json:"key"`
+			Value   json.RawMessage `json:"value"`
+			Version struct {
+				Number float64 `json:"number"`
+			} `json:"version"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return nil, err
+	}
+
+	for _, r := range respData.Results {
+		if r.Key == key {
+			return &PropertyDetail{
+				Key:     r.Key,
+				Value:   r.Value,
+				Version: r.Version.Number,
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (a *Api) setDocProperty(docId string, property *PropertyDetail) error {
+	url := a.domain + "/rest/api/content/" + docId + "/property"
+	options := map[string]string{
+		"Authorization": a.auth,
+		"Content-Type":  "application/json",
+	}
+	req := struct {
+		Key     string          `json:"key"`
+		Value   json.RawMessage `json:"value"`
+		Version *versionDetail  `json:"version,omitempty"`
+	}{
+		Key:   property.Key,
+		Value: property.Value,
+	}
+	if property.Version > 0 {
+		req.Version = &versionDetail{
+			Number: property.Version + 1,
+		}
+	}
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	if property.Version > 0 {
+		_, err = httputil.Put(url+"/"+property.Key, options, nil, reqBytes)
+	} else {
+		_, err = httputil.Post(url, options, nil, reqBytes)
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (a *Api) GetAttachment(docId string, fileName string) (*FileDetail, error) {
 	url := a.domain + "/rest/api/content/" + docId + "/child/attachment"
 	options := map[string]string{
@@ -343,6 +829,7 @@ func (a *Api) GetAttachment(docId string, fileName string) (*FileDetail, error)
 	}
 	params := map[string]string{
 		"filename": fileName,
+		"expand":   "version,metadata",
 	}
 	respBody, err := httputil.Get(url, options, params)
 	if err != nil {
@@ -351,10 +838,16 @@ func (a *Api) GetAttachment(docId string, fileName string) (*FileDetail, error)
 
 	var respData struct {
 		Results []struct {
-			Id     string `json:"id"`
-			Type   string `json:"type"`
-			Status string `json:"status"`
-			Title  string `json:"title"`
+			Id      string `json:"id"`
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Title   string `json:"title"`
+			Version struct {
+				Number float64 `json:"number"`
+			} `json:"version"`
+			Metadata struct {
+				Comment string `json:"comment"`
+			} `json:"metadata"`
 		} `json:"results"`
 	}
 	if err := json.Unmarshal(respBody, &respData); err != nil {
@@ -366,9 +859,11 @@ func (a *Api) GetAttachment(docId string, fileName string) (*FileDetail, error)
 	}
 
 	return &FileDetail{
-		Id:     respData.Results[0].Id,
-		Status: respData.Results[0].Status,
-		Type:   respData.Results[0].Type,
-		Title:  respData.Results[0].Title,
+		Id:      respData.Results[0].Id,
+		Status:  respData.Results[0].Status,
+		Type:    respData.Results[0].Type,
+		Title:   respData.Results[0].Title,
+		Version: respData.Results[0].Version.Number,
+		Comment: respData.Results[0].Metadata.Comment,
 	}, nil
 }
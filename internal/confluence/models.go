@@ -2,10 +2,14 @@ package confluence
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
+	"strings"
 	"yuque-sync-confluence/config"
 )
 
@@ -13,6 +17,8 @@ type Space struct {
 	SpaceInfo *SpaceBrief
 	Repos     []*Repo
 	ReposMap  map[string]*Repo
+	// 同步使用的Confluence账号，设置页面限制时总是保留该账号的权限
+	syncUser string
 }
 
 type Repo struct {
@@ -34,6 +40,10 @@ type DocDetail struct {
 	Mtime     uint64           `json:"mtime"`
 	Ancestors []AncestorDetail `json:"ancestors"`
 	Body      string           `json:"body"`
+	// 页面列表中返回的标签
+	Labels []string `json:"labels"`
+	// 页面列表中返回的是否设置过同步限制
+	Restricted bool `json:"restricted"`
 }
 
 type DocBrief struct {
@@ -54,6 +64,11 @@ type spaceDetail struct {
 	Key string `json:"key"`
 }
 
+type containerDetail struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+}
+
 type AncestorDetail struct {
 	Id string `json:"id"`
 }
@@ -68,7 +83,8 @@ type bodyDetail struct {
 }
 
 type versionDetail struct {
-	Number float64 `json:"number"`
+	Number  float64 `json:"number"`
+	Message string  `json:"message,omitempty"`
 }
 
 type SpaceBrief struct {
@@ -76,13 +92,51 @@ type SpaceBrief struct {
 	Key string `json:"key"`
 }
 
+type CommentDetail struct {
+	Id   string `json:"id"`
+	Body string `json:"body"`
+}
+
 type FileDetail struct {
-	Id     string `json:"id"`
-	Type   string `json:"type"`
-	Status string `json:"status"`
-	Title  string `json:"title"`
+	Id      string  `json:"id"`
+	Type    string  `json:"type"`
+	Status  string  `json:"status"`
+	Title   string  `json:"title"`
+	Version float64 `json:"version"`
+	Comment string  `json:"comment"`
+}
+
+// 记录同步添加的标签，用于区分手动添加的标签
+const syncedLabelsProperty = "yuque-sync-labels"
+
+// 记录页面限制是否由同步设置，用于区分手动设置的限制
+const syncedRestrictionsProperty = "yuque-sync-restrictions"
+
+// 同步上传的附件在备注中记录内容hash和来源的ETag，格式为 yuque-sync sha256=xxx etag=xxx
+const attachmentCommentPrefix = "yuque-sync"
+
+type labelDetail struct {
+	Prefix string `json:"prefix"`
+	Name   string `json:"name"`
+}
+
+type PropertyDetail struct {
+	Key     string          `json:"key"`
+	Value   json.RawMessage `json:"value"`
+	Version float64         `json:"version"`
+}
+
+type RestrictionDetail struct {
+	Operation string   `json:"operation"`
+	Users     []string `json:"users"`
+	Groups    []string `json:"groups"`
 }
 
+const (
+	RestrictionRead   = "read"
+	RestrictionUpdate = "update"
+)
+
 var client *Api
 
 func initClient(conf *config.ConfluenceConfig) {
@@ -188,6 +242,22 @@ func ConvertDocToTree(doc *DocDetail, docs []*DocDetail, parent *DocTree) *DocTr
 	return tree
 }
 
+// SyncUser 同步使用的Confluence账号用户名
+func (s *Space) SyncUser() (string, error) {
+	if s.syncUser != "" {
+		return s.syncUser, nil
+	}
+	user, err := client.getCurrentUser()
+	if err != nil {
+		return "", err
+	}
+	if user == "" {
+		return "", errors.New("confluence current user not found")
+	}
+	s.syncUser = user
+	return user, nil
+}
+
 func (s *Space) AddRepo(repo *RepoBrief) (*Repo, error) {
 	DocDetail, err := client.createDoc(repo.Title, repo.Ancestors, "")
 	if err != nil {
@@ -198,6 +268,7 @@ func (s *Space) AddRepo(repo *RepoBrief) (*Repo, error) {
 		RepoInfo: &RepoBrief{
 			Id:        DocDetail.Id,
 			Title:     DocDetail.Title,
+			Version:   DocDetail.Version,
 			Ancestors: DocDetail.Ancestors,
 			Mtime:     DocDetail.Mtime,
 		},
@@ -211,6 +282,56 @@ func (s *Space) AddRepo(repo *RepoBrief) (*Repo, error) {
 	return newRepo, nil
 }
 
+func (r *Repo) UpdateRepo(repoHtml string) error {
+	DocDetail, err := client.updateDoc(r.RepoInfo.Id, r.RepoInfo.Title, r.RepoInfo.Version+1, repoHtml, "")
+	if err != nil {
+		return err
+	}
+
+	r.RepoInfo.Version = DocDetail.Version
+	r.RepoInfo.Mtime = DocDetail.Mtime
+	return nil
+}
+
+// SyncRestrictions 根页面当前的限制与预期不一致时更新，限制会继承到所有子页面
+func (r *Repo) SyncRestrictions(restrictions []RestrictionDetail) error {
+	current, err := client.getDocRestrictions(r.RepoInfo.Id)
+	if err != nil {
+		return err
+	}
+	if sameRestrictions(current, restrictions) {
+		return nil
+	}
+
+	return client.updateDocRestrictions(r.RepoInfo.Id, restrictions)
+}
+
+func sameRestrictions(a []RestrictionDetail, b []RestrictionDetail) bool {
+	principals := func(restrictions []RestrictionDetail) map[string]bool {
+		m := make(map[string]bool)
+		for _, r := range restrictions {
+			for _, u := range r.Users {
+				m[r.Operation+"/user/"+u] = true
+			}
+			for _, g := range r.Groups {
+				m[r.Operation+"/group/"+g] = true
+			}
+		}
+		return m
+	}
+
+	am, bm := principals(a), principals(b)
+	if len(am) != len(bm) {
+		return false
+	}
+	for k := range am {
+		if !bm[k] {
+			return false
+		}
+	}
+	return true
+}
+
 func (r *Repo) ChildIndex(name string) int {
 	for i, c := range r.TreeInfo.Children {
 		if c.Title() == name {
@@ -247,6 +368,10 @@ func (t *DocTree) DocId() string {
 	return t.DocInfo.Id
 }
 
+func (t *DocTree) Labels() []string {
+	return t.DocInfo.Labels
+}
+
 func (t *DocTree) Title() string {
 	return t.DocInfo.Title
 }
@@ -277,22 +402,40 @@ func (t *DocTree) AddEmptyDoc(title string) (*DocTree, error) {
 }
 
 func (t *DocTree) UpdateDoc(title string, docHtml string) error {
-	DocDetail, err := client.updateDoc(t.DocInfo.Id, title, t.DocInfo.Version+1, docHtml)
+	return t.UpdateDocVersion(title, docHtml, "")
+}
+
+func (t *DocTree) UpdateDocVersion(title string, docHtml string, message string) error {
+	DocDetail, err := client.updateDoc(t.DocInfo.Id, title, t.DocInfo.Version+1, docHtml, message)
 	if err != nil {
 		return err
 	}
 
+	// 更新接口不返回标签和限制记录，保留页面列表中的值
+	DocDetail.Labels = t.DocInfo.Labels
+	DocDetail.Restricted = t.DocInfo.Restricted
 	t.DocInfo = DocDetail
 	return nil
 }
 
-func (t *DocTree) AddDocAttachment(fileBody []byte, fileName string) error {
-	// 判断文档是否有同名的附件
+// AddDocAttachment 同名附件内容未变化时跳过，变化时上传为附件的新版本
+// etag不为空且与已有附件记录的一致时，不再调用fetch下载文件
+func (t *DocTree) AddDocAttachment(fileName string, etag string, fetch func() ([]byte, error)) error {
 	fileDetail, err := client.GetAttachment(t.DocId(), fileName)
 	if err != nil {
 		return err
 	}
-	if fileDetail != nil {
+	if fileDetail != nil && etag != "" && fileDetail.Etag() == etag {
+		return nil
+	}
+
+	fileBody, err := fetch()
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(fileBody)
+	fileHash := hex.EncodeToString(hash[:])
+	if fileDetail != nil && fileDetail.Sha256() == fileHash {
 		return nil
 	}
 
@@ -302,10 +445,19 @@ func (t *DocTree) AddDocAttachment(fileBody []byte, fileName string) error {
 	if _, err := io.Copy(content, bytes.NewReader(fileBody)); err != nil {
 		return err
 	}
+	if err := writer.WriteField("comment", fmt.Sprintf("%s sha256=%s etag=%s", attachmentCommentPrefix, fileHash, etag)); err != nil {
+		return err
+	}
+	if err := writer.WriteField("minorEdit", "true"); err != nil {
+		return err
+	}
 	if err := writer.Close(); err != nil {
 		return err
 	}
 
+	if fileDetail != nil {
+		return client.updateAttachmentData(payload.Bytes(), t.DocId(), fileDetail.Id, writer.FormDataContentType())
+	}
 	if err := client.createAttachment(payload.Bytes(), t.DocId(), writer.FormDataContentType()); err != nil {
 		return err
 	}
@@ -313,6 +465,196 @@ func (t *DocTree) AddDocAttachment(fileBody []byte, fileName string) error {
 	return nil
 }
 
+// RemoveUnusedAttachments 删除页面内容不再引用的附件，手动上传的附件不会被删除
+func (t *DocTree) RemoveUnusedAttachments(referenced map[string]bool, purge bool) error {
+	files, err := client.getAttachmentListFull(t.DocId())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if referenced[f.Title] || !f.IsSynced() {
+			continue
+		}
+		if err := client.deleteAttachment(f.Id, purge); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *FileDetail) IsSynced() bool {
+	return strings.HasPrefix(f.Comment, attachmentCommentPrefix)
+}
+
+func (f *FileDetail) commentField(key string) string {
+	if !f.IsSynced() {
+		return ""
+	}
+	for _, field := range strings.Fields(f.Comment) {
+		if strings.HasPrefix(field, key+"=") {
+			return strings.TrimPrefix(field, key+"=")
+		}
+	}
+	return ""
+}
+
+func (f *FileDetail) Sha256() string {
+	return f.commentField("sha256")
+}
+
+func (f *FileDetail) Etag() string {
+	return f.commentField("etag")
+}
+
+func (t *DocTree) Property(key string, v interface{}) (*PropertyDetail, error) {
+	property, err := client.getDocProperty(t.DocId(), key)
+	if err != nil {
+		return nil, err
+	}
+	if property == nil {
+		return &PropertyDetail{
+			Key: key,
+		}, nil
+	}
+	if err := json.Unmarshal(property.Value, v); err != nil {
+		return nil, err
+	}
+
+	return property, nil
+}
+
+func (t *DocTree) SetProperty(property *PropertyDetail, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	property.Value = value
+	if err := client.setDocProperty(t.DocId(), property); err != nil {
+		return err
+	}
+	property.Version++
+
+	return nil
+}
+
+// SyncLabels 仅删除上次同步时添加、本次不再需要的标签，手动添加的标签保持不变
+func (t *DocTree) SyncLabels(labels []string) error {
+	syncedLabels := make([]string, 0)
+	property, err := t.Property(syncedLabelsProperty, &syncedLabels)
+	if err != nil {
+		return err
+	}
+	currentLabels, err := client.getDocLabels(t.DocId())
+	if err != nil {
+		return err
+	}
+
+	labelMap := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		labelMap[l] = true
+	}
+	currentMap := make(map[string]bool, len(currentLabels))
+	for _, l := range currentLabels {
+		currentMap[l] = true
+	}
+
+	changed := len(syncedLabels) != len(labels)
+	for _, l := range syncedLabels {
+		if !labelMap[l] {
+			changed = true
+			if currentMap[l] {
+				if err := client.deleteDocLabel(t.DocId(), l); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	addLabels := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if !currentMap[l] {
+			addLabels = append(addLabels, l)
+		}
+	}
+	if len(addLabels) > 0 {
+		if err := client.addDocLabels(t.DocId(), addLabels); err != nil {
+			return err
+		}
+	}
+
+	// 每次同步都会检查标签，记录的标签未变化时不再更新属性
+	if !changed {
+		return nil
+	}
+	return t.SetProperty(property, labels)
+}
+
+// Comments 页面的所有评论，包括回复
+func (t *DocTree) Comments() ([]*CommentDetail, error) {
+	return client.getCommentListFull(t.DocId())
+}
+
+// AddComment 添加页面底部评论，parentId不为空时作为该评论的回复
+func (t *DocTree) AddComment(parentId string, commentHtml string) (string, error) {
+	return client.createComment(t.DocId(), parentId, commentHtml)
+}
+
+// NewRestrictions 仅指定的用户和用户组可以查看、编辑页面，都为空时表示不限制
+func NewRestrictions(users []string, groups []string) []RestrictionDetail {
+	return []RestrictionDetail{
+		{
+			Operation: RestrictionRead,
+			Users:     users,
+			Groups:    groups,
+		},
+		{
+			Operation: RestrictionUpdate,
+			Users:     users,
+			Groups:    groups,
+		},
+	}
+}
+
+// SyncRestrictions 页面当前的限制与预期不一致时更新；预期不限制时只清除上次同步设置的限制，手动设置的限制保持不变
+func (t *DocTree) SyncRestrictions(restrictions []RestrictionDetail) error {
+	restrict := false
+	for _, r := range restrictions {
+		restrict = restrict || len(r.Users) > 0 || len(r.Groups) > 0
+	}
+	// 页面列表中已返回是否设置过限制，不需要限制也未设置过时不再请求
+	if !restrict && !t.DocInfo.Restricted {
+		return nil
+	}
+	synced := false
+	property, err := t.Property(syncedRestrictionsProperty, &synced)
+	if err != nil {
+		return err
+	}
+	if !restrict && !synced {
+		return nil
+	}
+
+	current, err := client.getDocRestrictions(t.DocId())
+	if err != nil {
+		return err
+	}
+	if !sameRestrictions(current, restrictions) {
+		if err := client.updateDocRestrictions(t.DocId(), restrictions); err != nil {
+			return err
+		}
+	}
+	if synced == restrict {
+		return nil
+	}
+	if err := t.SetProperty(property, restrict); err != nil {
+		return err
+	}
+
+	t.DocInfo.Restricted = restrict
+	return nil
+}
+
 func (t *DocTree) MarkDeprecated() error {
 	newDocName := "[Deprecated]" + t.Title()
 	newDocVersion := t.Version() + 1
@@ -0,0 +1,50 @@
+package converter
+
+import (
+	"yuque-sync-confluence/internal/httputil"
+)
+
+// ImageBackend 下载文档中的图片，默认直接请求图片地址
+type ImageBackend interface {
+	GetImage(url string) ([]byte, error)
+	// GetImageEtag 获取失败时返回空
+	GetImageEtag(url string) string
+}
+
+// AttachmentBackend 上传页面附件，默认为同步的Confluence页面
+type AttachmentBackend interface {
+	AddDocAttachment(fileName string, etag string, fetch func() ([]byte, error)) error
+}
+
+type httpImageBackend struct{}
+
+func (b *httpImageBackend) GetImage(url string) ([]byte, error) {
+	body, err := httputil.Get(url, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+func (b *httpImageBackend) GetImageEtag(url string) string {
+	header, err := httputil.Head(url, nil, nil)
+	if err != nil {
+		return ""
+	}
+	return header.Get("ETag")
+}
+
+// recordingAttachmentBackend 记录成功上传的附件名称
+type recordingAttachmentBackend struct {
+	backend   AttachmentBackend
+	fileNames []string
+}
+
+func (b *recordingAttachmentBackend) AddDocAttachment(fileName string, etag string, fetch func() ([]byte, error)) error {
+	if err := b.backend.AddDocAttachment(fileName, etag, fetch); err != nil {
+		return err
+	}
+	b.fileNames = append(b.fileNames, fileName)
+	return nil
+}
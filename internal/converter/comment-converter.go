@@ -0,0 +1,173 @@
+package converter
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"yuque-sync-confluence/config"
+	"yuque-sync-confluence/internal/confluence"
+	"yuque-sync-confluence/internal/yuque"
+)
+
+// 记录已同步的语雀评论id到Confluence评论id的映射，避免重复同步
+const syncedCommentsProperty = "yuque-sync-comments"
+
+// 记录评论中上传到页面的附件，清理页面附件时保留
+const commentAttachmentsProperty = "yuque-sync-comment-attachments"
+
+// 同步的评论开头带有该前缀的锚点，记录映射失败时通过锚点识别已同步的评论
+const commentAnchorPrefix = "yuque-comment-"
+
+var commentAnchorPattern = regexp.MustCompile(regexp.QuoteMeta(commentAnchorPrefix) + `(\d+)`)
+
+type CommentConverter struct {
+	yuqueDoc      *yuque.DocTree
+	confluenceDoc *confluence.DocTree
+	repoConfig    *config.RepoConfig
+	rules         []*Rule
+	linkResolver  *LinkResolver
+}
+
+func NewCommentConverter(yuqueDoc *yuque.DocTree, confluenceDoc *confluence.DocTree, repoConfig *config.RepoConfig,
+	rules []*Rule, linkResolver *LinkResolver) *CommentConverter {
+	return &CommentConverter{
+		yuqueDoc:      yuqueDoc,
+		confluenceDoc: confluenceDoc,
+		repoConfig:    repoConfig,
+		rules:         rules,
+		linkResolver:  linkResolver,
+	}
+}
+
+func (c *CommentConverter) Convert() error {
+	comments, err := c.yuqueDoc.Comments()
+	if err != nil {
+		return err
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+
+	synced := make(map[string]string)
+	property, err := c.confluenceDoc.Property(syncedCommentsProperty, &synced)
+	if err != nil {
+		return err
+	}
+	// 所有评论都已记录时不再读取页面评论
+	for _, comment := range comments {
+		if _, exist := synced[comment.Id]; !exist {
+			if err := c.MergeSyncedComments(synced); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	fileNames := make([]string, 0)
+	fileProperty, err := c.confluenceDoc.Property(commentAttachmentsProperty, &fileNames)
+	if err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		if _, exist := synced[comment.Id]; exist {
+			continue
+		}
+		commentHtml, commentFiles, err := c.CommentHtml(comment)
+		if err != nil {
+			return err
+		}
+		if len(commentFiles) > 0 {
+			fileNames = append(fileNames, commentFiles...)
+			if err := c.confluenceDoc.SetProperty(fileProperty, fileNames); err != nil {
+				return err
+			}
+		}
+		commentId, err := c.confluenceDoc.AddComment(synced[comment.ParentId], commentHtml)
+		if err != nil {
+			return err
+		}
+
+		// 每条评论添加成功后立即记录
+		synced[comment.Id] = commentId
+		if err := c.confluenceDoc.SetProperty(property, synced); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MergeSyncedComments 从页面已有评论的锚点中补充映射，避免添加评论后记录失败导致重复同步
+func (c *CommentConverter) MergeSyncedComments(synced map[string]string) error {
+	comments, err := c.confluenceDoc.Comments()
+	if err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		match := commentAnchorPattern.FindStringSubmatch(comment.Body)
+		if match == nil {
+			continue
+		}
+		if _, exist := synced[match[1]]; !exist {
+			synced[match[1]] = comment.Id
+		}
+	}
+	return nil
+}
+
+// CommentHtml 评论正文与文档正文一样按规则转换，图片等附件上传到页面，返回评论内容和上传的附件，
+// 转换结果不是合法的存储格式时只保留纯文本
+func (c *CommentConverter) CommentHtml(comment *yuque.CommentDetail) (string, []string, error) {
+	htmlConverter, err := NewFragmentConverter(c.yuqueDoc, comment.Body, c.confluenceDoc, c.repoConfig, c.rules, c.linkResolver)
+	if err != nil {
+		return "", nil, err
+	}
+	attachments := &recordingAttachmentBackend{
+		backend:   c.confluenceDoc,
+		fileNames: make([]string, 0),
+	}
+	htmlConverter.SetBackends(htmlConverter.imageBackend, attachments)
+	if err := htmlConverter.ConvertDocument(); err != nil {
+		return "", nil, err
+	}
+	body, err := htmlConverter.BodyHtml()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := ValidateStorage(body); err != nil {
+		log.Printf("doc %v comment %v fallback to plain text: %v", c.yuqueDoc.Title(), comment.Id, err)
+		body, err = c.PlainTextHtml(comment.Body)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	header, err := NewNode(html.ElementNode, "p").AddChild(
+		NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "anchor").
+			AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
+			NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", "").AddChild(
+				NewNode(html.TextNode, commentAnchorPrefix+comment.Id)))).AddChild(
+		NewNode(html.ElementNode, "strong").AddChild(
+			NewNode(html.TextNode, comment.Author))).AddChild(
+		NewNode(html.TextNode, fmt.Sprintf(" 于 %s 在语雀评论：",
+			time.Unix(int64(comment.Ctime), 0).Format("2006-01-02 15:04:05")))).Html()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return header + body, attachments.fileNames, nil
+}
+
+func (c *CommentConverter) PlainTextHtml(body string) (string, error) {
+	document, err := goquery.NewDocumentFromReader(strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	return NewNode(html.ElementNode, "p").AddChild(
+		NewNode(html.TextNode, strings.TrimSpace(document.Text()))).Html()
+}
@@ -10,12 +10,25 @@ import (
 )
 
 type Converter struct {
+	cfg             *config.Config
 	confluenceSpace *confluence.Space
 	yuqueSpace      *yuque.Space
-	err             error
+	linkResolver    *LinkResolver
+	// 按策略跳过同步的语雀文档标题，按知识库标题分组
+	skippedDocs map[string]map[string]bool
+	err         error
 }
 
 func NewConverter(cfg *config.Config) (*Converter, error) {
+	for title, repoConfig := range cfg.Repos {
+		if err := repoConfig.Validate(); err != nil {
+			return nil, errors.New(fmt.Sprintf("repo %v config invalid: %v", title, err))
+		}
+		if _, err := BuildRules(repoConfig); err != nil {
+			return nil, errors.New(fmt.Sprintf("repo %v rules invalid: %v", title, err))
+		}
+	}
+
 	confluenceSpace, err := confluence.NewSpace(cfg.Confluence)
 	if err != nil {
 		return nil, err
@@ -24,9 +37,26 @@ func NewConverter(cfg *config.Config) (*Converter, error) {
 	if err != nil {
 		return nil, err
 	}
+	skippedDocs := make(map[string]map[string]bool)
+	for _, repo := range yuqueSpace.Repos {
+		repoConfig := cfg.RepoConfig(repo.RepoInfo.Title)
+		skipped := make(map[string]bool)
+		repo.FilterDocs(func(doc *yuque.DocDetail) bool {
+			if DocPolicy(repoConfig, doc) == config.DocPolicySkip {
+				skipped[doc.Title] = true
+				return false
+			}
+			return true
+		})
+		skippedDocs[repo.RepoInfo.Title] = skipped
+	}
+
 	return &Converter{
+		cfg:             cfg,
 		confluenceSpace: confluenceSpace,
 		yuqueSpace:      yuqueSpace,
+		linkResolver:    NewLinkResolver(cfg.Yuque.Domain, confluenceSpace.SpaceInfo.Key, yuqueSpace.Repos),
+		skippedDocs:     skippedDocs,
 	}, nil
 }
 
@@ -43,6 +73,7 @@ func (c *Converter) Execute() error {
 	if err := c.ClearTempDocs(); err != nil {
 		return err
 	}
+	c.linkResolver.Report()
 
 	return nil
 }
@@ -91,7 +122,25 @@ func (c *Converter) ConvertRepos() error {
 			cRepo = repo
 		}
 
-		if err := c.ConvertRepo(yRepo, cRepo); err != nil {
+		// 先设置限制再发布根页面内容，避免私密知识库的内容短暂公开
+		if err := c.RestrictRepo(yRepo, cRepo); err != nil {
+			return err
+		}
+
+		// 规则每个知识库只生成一次，知识库下的所有文档共用
+		repoConfig := c.cfg.RepoConfig(yRepo.RepoInfo.Title)
+		rules, err := BuildRules(repoConfig)
+		if err != nil {
+			return err
+		}
+		if !exist || cRepo.RepoInfo.Mtime < yRepo.RepoInfo.Mtime {
+			repoConverter := NewRepoConverter(yRepo, cRepo, repoConfig, rules, c.linkResolver)
+			if err := repoConverter.Convert(); err != nil {
+				return err
+			}
+		}
+
+		if err := c.ConvertRepo(yRepo, cRepo, repoConfig, rules); err != nil {
 			return err
 		}
 	}
@@ -99,7 +148,79 @@ func (c *Converter) ConvertRepos() error {
 	return nil
 }
 
-func (c *Converter) ConvertRepo(yuqueRepo *yuque.Repo, confluenceRepo *confluence.Repo) error {
+// RestrictRepo 私密知识库仅知识库成员可以查看根页面，可编辑的成员可以编辑，同步账号总是可以查看和编辑；
+// 公开知识库默认不修改根页面的限制
+func (c *Converter) RestrictRepo(yuqueRepo *yuque.Repo, confluenceRepo *confluence.Repo) error {
+	repoConfig := c.cfg.RepoConfig(yuqueRepo.RepoInfo.Title)
+	read := confluence.RestrictionDetail{
+		Operation: confluence.RestrictionRead,
+		Users:     make([]string, 0),
+		Groups:    make([]string, 0),
+	}
+	update := confluence.RestrictionDetail{
+		Operation: confluence.RestrictionUpdate,
+		Users:     make([]string, 0),
+		Groups:    make([]string, 0),
+	}
+
+	if !yuqueRepo.IsPrivate() {
+		if !repoConfig.ClearPublicRestrictions {
+			return nil
+		}
+		return confluenceRepo.SyncRestrictions([]confluence.RestrictionDetail{read, update})
+	}
+
+	members, err := yuqueRepo.Members()
+	if err != nil {
+		return err
+	}
+	read.Users = append(read.Users, repoConfig.RestrictUsers...)
+	read.Groups = append(read.Groups, repoConfig.RestrictGroups...)
+	update.Users = append(update.Users, repoConfig.RestrictUsers...)
+	update.Groups = append(update.Groups, repoConfig.RestrictGroups...)
+
+	for _, m := range members {
+		user, group := c.cfg.Confluence.MapUser(m.Login)
+		if user != "" {
+			read.Users = append(read.Users, user)
+			if m.CanEdit() {
+				update.Users = append(update.Users, user)
+			}
+		}
+		if group != "" {
+			read.Groups = append(read.Groups, group)
+			if m.CanEdit() {
+				update.Groups = append(update.Groups, group)
+			}
+		}
+	}
+	// 空的限制等于公开，私密知识库没有可以映射的成员时中止同步
+	if len(read.Users) == 0 && len(read.Groups) == 0 {
+		return errors.New(fmt.Sprintf("private repo %v has no confluence users or groups to restrict to, "+
+			"configure restrict_users or restrict_groups", yuqueRepo.RepoInfo.Title))
+	}
+
+	syncUser, err := c.confluenceSpace.SyncUser()
+	if err != nil {
+		return err
+	}
+	read.Users = appendUnique(read.Users, syncUser)
+	update.Users = appendUnique(update.Users, syncUser)
+
+	return confluenceRepo.SyncRestrictions([]confluence.RestrictionDetail{read, update})
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+func (c *Converter) ConvertRepo(yuqueRepo *yuque.Repo, confluenceRepo *confluence.Repo, repoConfig *config.RepoConfig,
+	rules []*Rule) error {
 	yuqueTree := &yuque.DocTree{
 		DocInfo: &yuque.DocDetail{
 			Title: yuqueRepo.RepoInfo.Title,
@@ -117,43 +238,67 @@ func (c *Converter) ConvertRepo(yuqueRepo *yuque.Repo, confluenceRepo *confluenc
 		Children:    confluenceRepo.TreeInfo.Children,
 		ChildrenMap: confluenceRepo.TreeInfo.ChildrenMap,
 	}
-	if err := c.Convert(yuqueTree, confluenceTree); err != nil {
+	if err := c.Convert(yuqueTree, confluenceTree, repoConfig, rules); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (c *Converter) Convert(yuqueTree *yuque.DocTree, confluenceTree *confluence.DocTree) error {
+func (c *Converter) Convert(yuqueTree *yuque.DocTree, confluenceTree *confluence.DocTree, repoConfig *config.RepoConfig,
+	rules []*Rule) error {
 	for i := 0; i < yuqueTree.ChildCount(); i++ {
 		yTree := yuqueTree.ChildByIndex(i)
 		cTree := confluenceTree.ChildByName(yTree.Title())
 		if cTree != nil {
+			// 文档权限变化时不一定修改内容，每次同步都检查页面限制，且在更新内容之前设置
+			if err := c.RestrictDoc(yTree, cTree, repoConfig); err != nil {
+				return err
+			}
 			if cTree.Mtime() < yTree.Mtime() {
-				htmlConverter, err := NewHtmlConverter(yTree, cTree)
+				htmlConverter, err := NewHtmlConverter(yTree, cTree, repoConfig, rules, c.linkResolver)
 				if err != nil {
 					return err
 				}
 				if err := htmlConverter.Convert(); err != nil {
 					return err
 				}
+			} else if err := c.SyncLabels(yTree, cTree, repoConfig); err != nil {
+				// 标签变化时文档的更新时间不一定变化
+				return err
 			}
 		} else {
 			tree, err := confluenceTree.AddEmptyDoc(yTree.Title())
 			if err != nil {
 				return err
 			}
-			htmlConverter, err := NewHtmlConverter(yTree, tree)
-			if err != nil {
+			if err := c.RestrictDoc(yTree, tree, repoConfig); err != nil {
 				return err
 			}
-			if err := htmlConverter.Convert(); err != nil {
-				return err
+			if repoConfig.ReplayHistory {
+				// 回放历史版本后以当前内容作为最新版本发布
+				if err := NewHistoryConverter(yTree, tree, repoConfig, rules, c.linkResolver).Convert(); err != nil {
+					return err
+				}
+			} else {
+				htmlConverter, err := NewHtmlConverter(yTree, tree, repoConfig, rules, c.linkResolver)
+				if err != nil {
+					return err
+				}
+				if err := htmlConverter.Convert(); err != nil {
+					return err
+				}
 			}
 			cTree = tree
 		}
 
-		if err := c.Convert(yTree, cTree); err != nil {
+		if repoConfig.MirrorComments {
+			if err := NewCommentConverter(yTree, cTree, repoConfig, rules, c.linkResolver).Convert(); err != nil {
+				return err
+			}
+		}
+
+		if err := c.Convert(yTree, cTree, repoConfig, rules); err != nil {
 			return err
 		}
 	}
@@ -161,6 +306,76 @@ func (c *Converter) Convert(yuqueTree *yuque.DocTree, confluenceTree *confluence
 	return nil
 }
 
+// SyncLabels 内容未变化的文档只同步标签，标签取自文档列表，与页面列表中的标签一致时不再请求
+func (c *Converter) SyncLabels(yuqueTree *yuque.DocTree, confluenceTree *confluence.DocTree, repoConfig *config.RepoConfig) error {
+	labels := BuildLabels(DocTags(yuqueTree, yuqueTree.DocInfo), repoConfig)
+	if sameLabels(labels, confluenceTree.Labels()) {
+		return nil
+	}
+	return confluenceTree.SyncLabels(labels)
+}
+
+func sameLabels(labels []string, current []string) bool {
+	if len(labels) != len(current) {
+		return false
+	}
+	currentMap := make(map[string]bool, len(current))
+	for _, l := range current {
+		currentMap[l] = true
+	}
+	for _, l := range labels {
+		if !currentMap[l] {
+			return false
+		}
+	}
+	return true
+}
+
+// RestrictDoc restrict策略的文档仅配置的用户、用户组和同步账号可以查看、编辑，其他文档清除同步设置过的限制
+func (c *Converter) RestrictDoc(yuqueTree *yuque.DocTree, confluenceTree *confluence.DocTree, repoConfig *config.RepoConfig) error {
+	if DocPolicy(repoConfig, yuqueTree.DocInfo) != config.DocPolicyRestrict {
+		return confluenceTree.SyncRestrictions(confluence.NewRestrictions(make([]string, 0), make([]string, 0)))
+	}
+
+	syncUser, err := c.confluenceSpace.SyncUser()
+	if err != nil {
+		return err
+	}
+	users := appendUnique(append(make([]string, 0), repoConfig.RestrictUsers...), syncUser)
+	return confluenceTree.SyncRestrictions(confluence.NewRestrictions(users, repoConfig.RestrictGroups))
+}
+
+// HideDoc 改为跳过同步的文档，页面仅同步账号可以查看、编辑，子页面继承查看限制
+func (c *Converter) HideDoc(confluenceTree *confluence.DocTree) error {
+	syncUser, err := c.confluenceSpace.SyncUser()
+	if err != nil {
+		return err
+	}
+	return confluenceTree.SyncRestrictions(confluence.NewRestrictions([]string{syncUser}, make([]string, 0)))
+}
+
+// DocPolicy 草稿、私密文档按知识库配置的策略处理，同时命中时取更严格的策略
+func DocPolicy(repoConfig *config.RepoConfig, doc *yuque.DocDetail) string {
+	policies := make([]string, 0, 2)
+	if doc.IsDraft() {
+		policies = append(policies, repoConfig.DraftDocPolicy())
+	}
+	if doc.IsPrivate() {
+		policies = append(policies, repoConfig.PrivateDocPolicy())
+	}
+
+	policy := config.DocPolicySync
+	for _, p := range policies {
+		if p == config.DocPolicySkip {
+			return config.DocPolicySkip
+		}
+		if p == config.DocPolicyRestrict {
+			policy = config.DocPolicyRestrict
+		}
+	}
+	return policy
+}
+
 func (c *Converter) DeprecateDocs() error {
 	for _, yuqueRepo := range c.yuqueSpace.Repos {
 		if confluenceRepo, exist := c.confluenceSpace.ReposMap[yuqueRepo.RepoInfo.Title]; exist {
@@ -177,7 +392,7 @@ func (c *Converter) DeprecateDocs() error {
 				Children:    confluenceRepo.TreeInfo.Children,
 				ChildrenMap: confluenceRepo.TreeInfo.ChildrenMap,
 			}
-			if err := c.DeprecateChildDocs(yuqueTree, confluenceTree); err != nil {
+			if err := c.DeprecateChildDocs(yuqueTree, confluenceTree, c.skippedDocs[yuqueRepo.RepoInfo.Title]); err != nil {
 				return err
 			}
 		}
@@ -186,7 +401,8 @@ func (c *Converter) DeprecateDocs() error {
 	return nil
 }
 
-func (c *Converter) DeprecateChildDocs(yuqueTree *yuque.DocTree, confluenceTree *confluence.DocTree) error {
+// DeprecateChildDocs 语雀中已删除的文档标记为废弃，按策略跳过同步的文档隐藏页面，避免私密内容继续可见
+func (c *Converter) DeprecateChildDocs(yuqueTree *yuque.DocTree, confluenceTree *confluence.DocTree, skipped map[string]bool) error {
 	yuqueTitleMap := make(map[string]*yuque.DocTree, 0)
 	for i := 0; i < yuqueTree.ChildCount(); i++ {
 		yuqueTitleMap[yuqueTree.ChildByIndex(i).Title()] = yuqueTree.ChildByIndex(i)
@@ -194,7 +410,11 @@ func (c *Converter) DeprecateChildDocs(yuqueTree *yuque.DocTree, confluenceTree
 
 	for _, cTree := range confluenceTree.Children {
 		if yTree, exist := yuqueTitleMap[cTree.Title()]; exist {
-			if err := c.DeprecateChildDocs(yTree, cTree); err != nil {
+			if err := c.DeprecateChildDocs(yTree, cTree, skipped); err != nil {
+				return err
+			}
+		} else if skipped[cTree.Title()] {
+			if err := c.HideDoc(cTree); err != nil {
 				return err
 			}
 		} else {
@@ -0,0 +1,110 @@
+package converter
+
+import (
+	"fmt"
+	"time"
+	"yuque-sync-confluence/config"
+	"yuque-sync-confluence/internal/confluence"
+	"yuque-sync-confluence/internal/yuque"
+)
+
+// 记录回放的历史版本引用的附件，清理页面附件时保留，避免历史版本中的图片失效
+const historyAttachmentsProperty = "yuque-sync-history-attachments"
+
+// HistoryConverter 将语雀历史版本按时间顺序发布为Confluence页面的历史版本
+type HistoryConverter struct {
+	yuqueDoc      *yuque.DocTree
+	confluenceDoc *confluence.DocTree
+	repoConfig    *config.RepoConfig
+	rules         []*Rule
+	linkResolver  *LinkResolver
+}
+
+func NewHistoryConverter(yuqueDoc *yuque.DocTree, confluenceDoc *confluence.DocTree, repoConfig *config.RepoConfig,
+	rules []*Rule, linkResolver *LinkResolver) *HistoryConverter {
+	return &HistoryConverter{
+		yuqueDoc:      yuqueDoc,
+		confluenceDoc: confluenceDoc,
+		repoConfig:    repoConfig,
+		rules:         rules,
+		linkResolver:  linkResolver,
+	}
+}
+
+// Convert 依次发布历史版本，最后发布当前内容，页面的每个版本都带有语雀的编辑信息
+func (c *HistoryConverter) Convert() error {
+	current, err := c.yuqueDoc.Detail()
+	if err != nil {
+		return err
+	}
+	versions, err := c.yuqueDoc.Versions()
+	if err != nil {
+		return err
+	}
+
+	// 历史版本引用的附件，发布当前内容后清理附件时保留
+	historyFiles := make([]string, 0)
+	seen := make(map[string]bool)
+	for i, version := range versions {
+		detail, err := c.yuqueDoc.VersionDetail(version.Id)
+		if err != nil {
+			return err
+		}
+		// 最新版本与当前内容一致时不重复发布，由当前内容代替
+		if i == len(versions)-1 && sameBody(detail, current) {
+			break
+		}
+		htmlConverter, err := NewHtmlConverterWithDetail(c.yuqueDoc, detail, c.confluenceDoc, c.repoConfig, c.rules, c.linkResolver)
+		if err != nil {
+			return err
+		}
+		if err := htmlConverter.ConvertDocument(); err != nil {
+			return err
+		}
+		if err := htmlConverter.UpdateDocVersion(versionMessage("语雀历史版本", version.Author, version.Mtime)); err != nil {
+			return err
+		}
+		for _, fileName := range htmlConverter.AttachmentNames() {
+			if !seen[fileName] {
+				seen[fileName] = true
+				historyFiles = append(historyFiles, fileName)
+			}
+		}
+	}
+	if len(historyFiles) > 0 {
+		existing := make([]string, 0)
+		property, err := c.confluenceDoc.Property(historyAttachmentsProperty, &existing)
+		if err != nil {
+			return err
+		}
+		if err := c.confluenceDoc.SetProperty(property, historyFiles); err != nil {
+			return err
+		}
+	}
+
+	htmlConverter, err := NewHtmlConverterWithDetail(c.yuqueDoc, current, c.confluenceDoc, c.repoConfig, c.rules, c.linkResolver)
+	if err != nil {
+		return err
+	}
+	htmlConverter.SetVersionMessage(versionMessage("语雀当前版本", c.Editor(current, versions), c.yuqueDoc.Mtime()))
+	return htmlConverter.Convert()
+}
+
+// Editor 当前内容的最后编辑者，文档详情中没有时使用最新历史版本的作者，都没有时使用文档作者
+func (c *HistoryConverter) Editor(current *yuque.DocDetail, versions []*yuque.VersionDetail) string {
+	if current.Editor != "" {
+		return current.Editor
+	}
+	if len(versions) > 0 && versions[len(versions)-1].Author != "" {
+		return versions[len(versions)-1].Author
+	}
+	return current.Author
+}
+
+func versionMessage(prefix string, author string, mtime uint64) string {
+	return fmt.Sprintf("%s：%s 编辑于 %s", prefix, author, time.Unix(int64(mtime), 0).Format("2006-01-02 15:04:05"))
+}
+
+func sameBody(detail *yuque.DocDetail, current *yuque.DocDetail) bool {
+	return detail.Body == current.Body && detail.BodyLake == current.BodyLake && detail.BodyMarkdown == current.BodyMarkdown
+}
@@ -0,0 +1,62 @@
+package converter
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"strings"
+)
+
+// 语雀提示块类型到Confluence宏的映射
+var alertMacros = map[string]string{
+	"info":    "info",
+	"tips":    "tip",
+	"tip":     "tip",
+	"success": "tip",
+	"warning": "note",
+	"warn":    "note",
+	"danger":  "warning",
+	"error":   "warning",
+}
+
+// ConvertAlert 将语雀提示块转换为Confluence的info、note、warning、tip宏
+func (c *HtmlConverter) ConvertAlert(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
+		macro := alertMacros[c.AlertType(selection)]
+		if macro == "" {
+			macro = "info"
+		}
+
+		node := NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", macro).
+			AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString())
+
+		title, exist := selection.Attr("data-title")
+		if titleNode := selection.ChildrenFiltered(".ne-alert-title"); titleNode.Length() > 0 {
+			title, exist = titleNode.Text(), true
+			titleNode.Remove()
+		}
+		if exist && strings.TrimSpace(title) != "" {
+			node.AddChild(
+				NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", "title").AddChild(
+					NewNode(html.TextNode, strings.TrimSpace(title))))
+		}
+
+		selection.ReplaceWithNodes(
+			node.AddChild(
+				NewNode(html.ElementNode, "ac:rich-text-body").AddChildren(
+					BuildNodes(c.cloneNodes(selection.Contents().Nodes)))).Node())
+	})
+}
+
+func (c *HtmlConverter) AlertType(selection *goquery.Selection) string {
+	if alertType, exist := selection.Attr("data-type"); exist {
+		return strings.ToLower(alertType)
+	}
+	class, _ := selection.Attr("class")
+	for _, cls := range strings.Fields(class) {
+		if strings.HasPrefix(cls, "ne-alert-") {
+			return strings.TrimPrefix(cls, "ne-alert-")
+		}
+	}
+	return ""
+}
@@ -1,98 +1,418 @@
 package converter
 
 import (
+	"errors"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/google/uuid"
 	"golang.org/x/net/html"
+	"hash/fnv"
+	"log"
+	"mime"
+	"net/url"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
+	"yuque-sync-confluence/config"
 	"yuque-sync-confluence/internal/confluence"
-	"yuque-sync-confluence/internal/httputil"
 	"yuque-sync-confluence/internal/yuque"
 )
 
 type HtmlConverter struct {
 	yuqueDoc      *yuque.DocTree
+	yuqueDetail   *yuque.DocDetail
 	confluenceDoc *confluence.DocTree
+	repoConfig    *config.RepoConfig
+	linkResolver  *LinkResolver
+
+	imageBackend      ImageBackend
+	attachmentBackend AttachmentBackend
 
 	document *goquery.Document
+	// 知识库的规则执行列表
+	rules []*Rule
+	// 评论等页面片段不执行页面级规则
+	fragment bool
+	// 更新页面时的版本说明
+	message string
+	// 上传失败的附件，页面上已有的同名附件不清理
+	failedAttachments map[string]bool
+}
+
+func NewHtmlConverter(yuqueDoc *yuque.DocTree, confluenceDoc *confluence.DocTree, repoConfig *config.RepoConfig,
+	rules []*Rule, linkResolver *LinkResolver) (*HtmlConverter, error) {
+	yuqueDetail, err := yuqueDoc.Detail()
+	if err != nil {
+		return nil, err
+	}
+	return NewHtmlConverterWithDetail(yuqueDoc, yuqueDetail, confluenceDoc, repoConfig, rules, linkResolver)
 }
 
-func NewHtmlConverter(yuqueDoc *yuque.DocTree, confluenceDoc *confluence.DocTree) (*HtmlConverter, error) {
-	yuqueDocHtml, err := yuqueDoc.DocHtml()
+func NewHtmlConverterWithDetail(yuqueDoc *yuque.DocTree, yuqueDetail *yuque.DocDetail, confluenceDoc *confluence.DocTree,
+	repoConfig *config.RepoConfig, rules []*Rule, linkResolver *LinkResolver) (*HtmlConverter, error) {
+	document, err := goquery.NewDocumentFromReader(strings.NewReader(yuqueDetail.Body))
 	if err != nil {
 		return nil, err
 	}
-	document, err := goquery.NewDocumentFromReader(strings.NewReader(yuqueDocHtml))
+
+	c := &HtmlConverter{
+		yuqueDoc:      yuqueDoc,
+		yuqueDetail:   yuqueDetail,
+		confluenceDoc: confluenceDoc,
+		repoConfig:    repoConfig,
+		linkResolver:  linkResolver,
+		document:      document,
+		rules:         rules,
+
+		imageBackend:      &httpImageBackend{},
+		attachmentBackend: confluenceDoc,
+	}
+
+	switch converter := repoConfig.DocConverter(); converter {
+	case config.ConverterLake, config.ConverterMarkdown:
+		sourceDocument, err := c.SourceDocument(converter)
+		if err != nil {
+			log.Printf("doc %v %v convert failed, fallback to html: %v", yuqueDoc.Title(), converter, err)
+		} else {
+			c.document = sourceDocument
+		}
+	}
+
+	return c, nil
+}
+
+// NewFragmentConverter 转换评论等页面片段，附件上传到所在页面，不生成目录和来源说明
+func NewFragmentConverter(yuqueDoc *yuque.DocTree, body string, confluenceDoc *confluence.DocTree,
+	repoConfig *config.RepoConfig, rules []*Rule, linkResolver *LinkResolver) (*HtmlConverter, error) {
+	document, err := goquery.NewDocumentFromReader(strings.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 
 	return &HtmlConverter{
 		yuqueDoc:      yuqueDoc,
+		yuqueDetail:   &yuque.DocDetail{Body: body},
 		confluenceDoc: confluenceDoc,
+		repoConfig:    repoConfig,
+		linkResolver:  linkResolver,
 		document:      document,
+		rules:         rules,
+		fragment:      true,
+
+		imageBackend:      &httpImageBackend{},
+		attachmentBackend: confluenceDoc,
 	}, nil
 }
 
 func (c *HtmlConverter) Convert() error {
-	c.ConvertStrongSeparator()
-	c.ConvertCode()
-	c.ConvertImg()
-	c.ConvertSvg()
-	c.ConvertList()
-	c.ConvertTodoList()
-	c.ConvertFirstDiv()
+	if err := c.ConvertDocument(); err != nil {
+		return err
+	}
 
 	if err := c.UpdateDoc(); err != nil {
 		return err
 	}
 
+	return c.SyncLabels()
+}
+
+func (c *HtmlConverter) SyncLabels() error {
+	return c.confluenceDoc.SyncLabels(BuildLabels(DocTags(c.yuqueDoc, c.yuqueDetail), c.repoConfig))
+}
+
+func (c *HtmlConverter) ConvertDocument() error {
+	for _, rule := range c.rules {
+		if c.fragment && pageRules[rule.Name] {
+			continue
+		}
+		rule.Transform(c, c.document.Find(rule.Selector))
+	}
+
 	return nil
 }
 
+func (c *HtmlConverter) BodyHtml() (string, error) {
+	return c.document.Find("body").Html()
+}
+
 func (c *HtmlConverter) UpdateDoc() error {
-	htmlBody, err := c.document.Find("html").Html()
+	htmlBody, sanitized, err := c.StorageHtml()
 	if err != nil {
 		return err
 	}
-	if err := c.confluenceDoc.UpdateDoc(strings.TrimPrefix(c.confluenceDoc.Title(), "[Temp]"), htmlBody); err != nil {
+	title := strings.TrimPrefix(c.confluenceDoc.Title(), "[Temp]")
+	if err := c.confluenceDoc.UpdateDocVersion(title, htmlBody, c.message); err != nil {
 		return err
 	}
+	// 纯文本内容不引用附件，保留已有附件
+	if !sanitized {
+		if err := c.RemoveUnusedAttachments(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (c *HtmlConverter) ConvertStrongSeparator() {
-	c.document.Find("strong").Each(func(i int, selection *goquery.Selection) {
+func (c *HtmlConverter) SetVersionMessage(message string) {
+	c.message = message
+}
+
+// UpdateDocVersion 仅更新页面内容并保留标题，用于回放历史版本
+func (c *HtmlConverter) UpdateDocVersion(message string) error {
+	htmlBody, _, err := c.StorageHtml()
+	if err != nil {
+		return err
+	}
+	return c.confluenceDoc.UpdateDocVersion(c.confluenceDoc.Title(), htmlBody, message)
+}
+
+// StorageHtml 校验后的页面内容，第二个返回值表示是否已回退为纯文本
+func (c *HtmlConverter) StorageHtml() (string, bool, error) {
+	htmlBody, err := c.document.Find("html").Html()
+	if err != nil {
+		return "", false, err
+	}
+	return c.ValidateOrFallback(htmlBody)
+}
+
+// ValidateOrFallback 上传前校验存储格式，校验失败时按配置返回错误或回退为纯文本内容，第二个返回值表示是否已回退
+func (c *HtmlConverter) ValidateOrFallback(htmlBody string) (string, bool, error) {
+	err := ValidateStorage(htmlBody)
+	if err == nil {
+		return htmlBody, false, nil
+	}
+	if !c.repoConfig.StorageFallback {
+		return "", false, errors.New(fmt.Sprintf("doc %v: %v", c.yuqueDoc.Title(), err))
+	}
+
+	log.Printf("doc %v fallback to plain text: %v", c.yuqueDoc.Title(), err)
+	sanitizedHtml, err := c.SanitizedHtml()
+	if err != nil {
+		return "", false, err
+	}
+	return sanitizedHtml, true, nil
+}
+
+// SanitizedHtml 将语雀正文按段落输出为纯文本，并提示前往语雀查看完整内容
+func (c *HtmlConverter) SanitizedHtml() (string, error) {
+	document, err := goquery.NewDocumentFromReader(strings.NewReader(c.yuqueDetail.Body))
+	if err != nil {
+		return "", err
+	}
+
+	body := NewNode(html.ElementNode, "div").AddChild(
+		NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "warning").
+			AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
+			NewNode(html.ElementNode, "ac:rich-text-body").AddChild(
+				NewNode(html.ElementNode, "p").AddChild(
+					NewNode(html.TextNode, "页面内容转换失败，仅保留纯文本，完整内容请查看")).AddChild(
+					NewNode(html.ElementNode, "a").AddAttr("href", c.yuqueDoc.Url()).AddChild(
+						NewNode(html.TextNode, "语雀原文"))))))
+
+	blocks := "p, h1, h2, h3, h4, h5, h6, li, pre, td, th, blockquote"
+	document.Find(blocks).Each(func(i int, selection *goquery.Selection) {
+		// 只输出最内层的块，避免重复
+		if selection.Find(blocks).Length() > 0 {
+			return
+		}
+		text := strings.TrimSpace(selection.Text())
+		if text == "" {
+			return
+		}
+		body.AddChild(
+			NewNode(html.ElementNode, "p").AddChild(
+				NewNode(html.TextNode, text)))
+	})
+
+	return body.Html()
+}
+
+func (c *HtmlConverter) RemoveUnusedAttachments() error {
+	mode := c.repoConfig.AttachmentGcMode()
+	if mode == config.AttachmentGcOff {
+		return nil
+	}
+
+	// 评论和回放的历史版本中的附件也上传到页面，不在正文中引用
+	referenced := make(map[string]bool)
+	for _, key := range []string{commentAttachmentsProperty, historyAttachmentsProperty} {
+		fileNames := make([]string, 0)
+		if _, err := c.confluenceDoc.Property(key, &fileNames); err != nil {
+			return err
+		}
+		for _, fileName := range fileNames {
+			referenced[fileName] = true
+		}
+	}
+	for fileName := range c.failedAttachments {
+		referenced[fileName] = true
+	}
+	for _, fileName := range c.AttachmentNames() {
+		referenced[fileName] = true
+	}
+
+	return c.confluenceDoc.RemoveUnusedAttachments(referenced, mode == config.AttachmentGcDelete)
+}
+
+// AttachmentNames 转换后的正文中引用的附件
+func (c *HtmlConverter) AttachmentNames() []string {
+	fileNames := make([]string, 0)
+	c.document.Find("ri\\:attachment").Each(func(i int, selection *goquery.Selection) {
+		if fileName, exist := selection.Attr("ri:filename"); exist {
+			fileNames = append(fileNames, fileName)
+		}
+	})
+	return fileNames
+}
+
+// ConvertEmptyParagraph 删除语雀中用于留白的空段落，默认不启用
+func (c *HtmlConverter) ConvertEmptyParagraph(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
+		if strings.TrimSpace(selection.Text()) != "" || selection.Find("*").Not("br, span").Length() > 0 {
+			return
+		}
+		selection.Remove()
+	})
+}
+
+func (c *HtmlConverter) ConvertStrongSeparator(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
 		if selection.Text() == "" {
 			selection.ReplaceWithNodes(selection.Children().Nodes...)
 		}
 	})
 }
 
-func (c *HtmlConverter) ConvertCode() {
-	c.document.Find("pre").Each(func(i int, selection *goquery.Selection) {
+func (c *HtmlConverter) ConvertLink(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
+		href, _ := selection.Attr("href")
+		link, originUrl := c.linkResolver.Resolve(c.yuqueDoc.Title(), href)
+		if link == nil {
+			selection.SetAttr("href", originUrl)
+			return
+		}
+
+		node := NewNode(html.ElementNode, "ac:link")
+		if link.Anchor != "" {
+			node.AddAttr("ac:anchor", link.Anchor)
+		}
 		selection.ReplaceWithNodes(
-			NewNode(html.ElementNode, "ac:structured-macro").
-				AddAttr("ac:name", "code").AddAttr("ac:schema-version", "1").
-				AddAttr("ac:macro-id", uuid.New().String()).AddChild(
-				NewNode(html.ElementNode, "ac:plain-text-body").AddChild(
-					NewNode(html.RawNode, "<![CDATA["+selection.Text()+"]]>"))).Node())
+			node.AddChild(
+				NewNode(html.ElementNode, "ri:page").AddAttr("ri:content-title", link.Title).
+					AddAttr("ri:space-key", link.SpaceKey)).AddChild(
+				NewNode(html.ElementNode, "ac:plain-text-link-body").AddChild(
+					NewCDataNode(selection.Text()))).Node())
+	})
+}
+
+func (c *HtmlConverter) ConvertCode(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
+		language, exist := selection.Attr("data-language")
+		if !exist {
+			class, _ := selection.Attr("class")
+			for _, cls := range strings.Fields(class) {
+				if strings.HasPrefix(cls, "language-") {
+					language = strings.TrimPrefix(cls, "language-")
+				}
+			}
+		}
+		title, _ := selection.Attr("data-title")
+		lineNumbers, _ := selection.Attr("data-line-numbers")
+		collapse, _ := selection.Attr("data-collapsed")
+
+		selection.ReplaceWithNodes(
+			c.CodeMacro(selection.Text(), &CodeOptions{
+				Language:    c.repoConfig.CodeLanguage(language),
+				Title:       title,
+				LineNumbers: lineNumbers == "true",
+				Collapse:    collapse == "true",
+			}).Node())
 	})
 }
 
-func (c *HtmlConverter) ConvertFirstDiv() {
-	div := c.document.Find("div").First()
+type CodeOptions struct {
+	Language    string
+	Title       string
+	LineNumbers bool
+	Collapse    bool
+}
+
+func (c *HtmlConverter) CodeMacro(code string, options *CodeOptions) *Node {
+	node := NewNode(html.ElementNode, "ac:structured-macro").
+		AddAttr("ac:name", "code").AddAttr("ac:schema-version", "1").
+		AddAttr("ac:macro-id", uuid.New().String())
+
+	params := [][2]string{
+		{"language", options.Language},
+		{"title", options.Title},
+	}
+	if options.LineNumbers {
+		params = append(params, [2]string{"linenumbers", "true"})
+	}
+	if options.Collapse {
+		params = append(params, [2]string{"collapse", "true"})
+	}
+	for _, param := range params {
+		if param[1] == "" {
+			continue
+		}
+		node.AddChild(
+			NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", param[0]).AddChild(
+				NewNode(html.TextNode, param[1])))
+	}
+
+	return node.AddChild(
+		NewNode(html.ElementNode, "ac:plain-text-body").AddChild(
+			NewCDataNode(code)))
+}
+
+func (c *HtmlConverter) ConvertFirstDiv(selections *goquery.Selection) {
+	div := selections.First()
 
 	div.RemoveAttr("class")
 	div.RemoveAttr("typography")
 
-	div.AppendNodes(
-		NewNode(html.ElementNode, "span").AddAttr("class", "ne-text").AddChild(
-			NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "easy-heading-free").
-				AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString())).Node())
+	switch c.repoConfig.TocMacro() {
+	case config.TocMacroToc:
+		div.PrependNodes(
+			NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "toc").
+				AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).Node())
+	case config.TocMacroEasyHeading:
+		div.AppendNodes(
+			NewNode(html.ElementNode, "span").AddAttr("class", "ne-text").AddChild(
+				NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "easy-heading-free").
+					AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString())).Node())
+	}
+}
+
+func (c *HtmlConverter) ConvertAttribution(selections *goquery.Selection) {
+	attribution := c.repoConfig.AttributionPanel()
+	if attribution.Disable {
+		return
+	}
+
+	timeLayout := "2006-01-02 15:04:05"
+	mtime := c.yuqueDetail.Mtime
+	if mtime == 0 {
+		mtime = c.yuqueDoc.Mtime()
+	}
+	selections.PrependNodes(
+		NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "info").
+			AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
+			NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", "title").AddChild(
+				NewNode(html.TextNode, attribution.Title))).AddChild(
+			NewNode(html.ElementNode, "ac:rich-text-body").AddChild(
+				NewNode(html.ElementNode, "p").AddChild(
+					NewNode(html.TextNode, attribution.Message+"：")).AddChild(
+					NewNode(html.ElementNode, "a").AddAttr("href", c.yuqueDoc.Url()).AddChild(
+						NewNode(html.TextNode, c.yuqueDoc.Title())))).AddChild(
+				NewNode(html.ElementNode, "p").AddChild(
+					NewNode(html.TextNode, fmt.Sprintf("作者：%s | 语雀更新时间：%s | 同步时间：%s",
+						c.yuqueDetail.Author,
+						time.Unix(int64(mtime), 0).Format(timeLayout),
+						time.Now().Format(timeLayout)))))).Node())
 }
 
 func (c *HtmlConverter) ConvertSvgHtml(svgText string) (string, error) {
@@ -113,8 +433,8 @@ func (c *HtmlConverter) ConvertSvgHtml(svgText string) (string, error) {
 	return svgHtml, nil
 }
 
-func (c *HtmlConverter) ConvertSvg() {
-	c.document.Find("img").Each(func(i int, selection *goquery.Selection) {
+func (c *HtmlConverter) ConvertSvg(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
 		url, exist := selection.Attr("src")
 		if !exist {
 			return
@@ -135,7 +455,7 @@ func (c *HtmlConverter) ConvertSvg() {
 			NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "html").
 				AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
 				NewNode(html.ElementNode, "ac:plain-text-body").AddChild(
-					NewNode(html.RawNode, "<![CDATA["+svgHtml+"]]>"))).Node())
+					NewCDataNode(svgHtml))).Node())
 	})
 }
 
@@ -144,16 +464,35 @@ func (c *HtmlConverter) IsSvg(url string) bool {
 }
 
 func (c *HtmlConverter) GetImage(url string) ([]byte, error) {
-	body, err := httputil.Get(url, nil, nil)
+	return c.imageBackend.GetImage(url)
+}
+
+// GetImageEtag 获取失败时返回空，此时总是下载图片比较内容hash
+func (c *HtmlConverter) GetImageEtag(url string) string {
+	return c.imageBackend.GetImageEtag(url)
+}
+
+// AddAttachment 上传附件到页面，失败时记录文件名，清理附件时保留上一次同步上传的同名附件
+func (c *HtmlConverter) AddAttachment(fileName string, etag string, fetch func() ([]byte, error)) error {
+	err := c.attachmentBackend.AddDocAttachment(fileName, etag, fetch)
 	if err != nil {
-		return nil, err
+		log.Printf("doc %v attachment %v upload failed: %v", c.yuqueDoc.Title(), fileName, err)
+		if c.failedAttachments == nil {
+			c.failedAttachments = make(map[string]bool)
+		}
+		c.failedAttachments[fileName] = true
 	}
+	return err
+}
 
-	return body, nil
+// SetBackends 替换图片下载和附件上传的实现
+func (c *HtmlConverter) SetBackends(imageBackend ImageBackend, attachmentBackend AttachmentBackend) {
+	c.imageBackend = imageBackend
+	c.attachmentBackend = attachmentBackend
 }
 
-func (c *HtmlConverter) ConvertImg() {
-	c.document.Find("img").Each(func(i int, selection *goquery.Selection) {
+func (c *HtmlConverter) ConvertImg(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
 		url, exist := selection.Attr("src")
 		if !exist {
 			return
@@ -161,12 +500,11 @@ func (c *HtmlConverter) ConvertImg() {
 		if c.IsSvg(url) {
 			return
 		}
-		body, err := c.GetImage(url)
-		if err != nil {
-			return
-		}
 		fileName := filepath.Base(url)
-		if err := c.confluenceDoc.AddDocAttachment(body, fileName); err != nil {
+		err := c.AddAttachment(fileName, c.GetImageEtag(url), func() ([]byte, error) {
+			return c.GetImage(url)
+		})
+		if err != nil {
 			return
 		}
 
@@ -176,103 +514,90 @@ func (c *HtmlConverter) ConvertImg() {
 	})
 }
 
-func (c *HtmlConverter) ConvertList() {
-	c.document.Find("ul:not([ne-level]), ol:not([ne-level])").Each(func(i int, selection *goquery.Selection) {
-		class, exist := selection.Attr("class")
-		if !exist {
-			return
-		}
-		data := goquery.NodeName(selection)
-
-		selection.ReplaceWithNodes(
-			NewNode(html.ElementNode, data).AddAttr("class", class).AddAttr("ne-level", "0").AddChildren(
-				BuildNodes(c.cloneNodes(selection.Children().Nodes))).AddChildren(
-				BuildNodes(c.ConvertNode(selection, 1))).Node())
-	})
-
-	ul := c.document.Find("ul[ne-level=\"0\"], ol[ne-level=\"0\"]").First()
-	for {
-		ul = c.mergeAdjoinNode(ul, 0)
-		if ul == nil || len(ul.Nodes) == 0 {
-			break
-		}
-	}
+var fileMimeTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".zip":  "application/zip",
+	".rar":  "application/x-rar-compressed",
+	".7z":   "application/x-7z-compressed",
+	".gz":   "application/gzip",
+	".txt":  "text/plain",
+	".csv":  "text/csv",
+	".doc":  "application/msword",
+	".xls":  "application/vnd.ms-excel",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
 }
 
-func (c *HtmlConverter) ConvertNode(selection *goquery.Selection, level int) []*html.Node {
-	children := make([]*html.Node, 0)
-	n := selection.Next()
-	for {
-		if !n.HasClass("ne-list-wrap") || n.Find(fmt.Sprintf("[ne-level=\"%d\"]", level)) == nil ||
-			len(n.Find(fmt.Sprintf("[ne-level=\"%d\"]", level)).Nodes) == 0 {
-			break
-		}
-		class, exist := selection.Attr("class")
-		if !exist {
-			n = n.Next()
-			continue
-		}
-		data := goquery.NodeName(n)
-
-		children = append(children,
-			NewNode(html.ElementNode, data).AddAttr("class", class).
-				AddAttr("ne-level", strconv.FormatInt(int64(level), 10)).AddChildren(
-				BuildNodes(c.cloneNodes(n.Find(fmt.Sprintf("[ne-level=\"%d\"]", level)).Children().Nodes))).AddChildren(
-				BuildNodes(c.ConvertNode(n, level+1))).Node())
-		oldn := n
-		n = n.Next()
-		oldn.Remove()
+func (c *HtmlConverter) FileMimeType(fileName string) string {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if mimeType, exist := fileMimeTypes[ext]; exist {
+		return mimeType
 	}
-
-	return children
+	if mimeType := mime.TypeByExtension(ext); mimeType != "" {
+		return strings.TrimSpace(strings.Split(mimeType, ";")[0])
+	}
+	return "application/octet-stream"
 }
 
-func (c *HtmlConverter) mergeAdjoinNode(selection *goquery.Selection, level int) *goquery.Selection {
-	selectionSet := make([]*goquery.Selection, 0)
-	if selection == nil {
-		return nil
-	}
-	if !selection.Is(fmt.Sprintf(fmt.Sprintf("ul[ne-level=\"%d\"], ol[ne-level=\"%d\"]", level, level))) {
-		return selection.Next()
-	}
-	class, exist := selection.Attr("class")
-	if !exist {
-		return selection.Next()
-	}
-	data := goquery.NodeName(selection)
-	n := selection
+// IsFile 语雀文件卡片渲染为指向语雀域名下 /attachments/ 的链接，u为按文档地址解析后的绝对地址
+func (c *HtmlConverter) IsFile(u *url.URL) bool {
+	return yuque.IsYuqueHost(u.Host) && strings.Contains(u.Path, "/attachments/")
+}
 
-	for {
-		if !n.Is(fmt.Sprintf("[ne-level=\"%d\"][class=%s]", level, class)) {
-			break
+func (c *HtmlConverter) ConvertFile(selections *goquery.Selection) {
+	rule := c.repoConfig.AttachmentRule()
+	selections.Each(func(i int, selection *goquery.Selection) {
+		href, _ := selection.Attr("href")
+		u, err := url.Parse(href)
+		if err != nil || !strings.Contains(u.Path, "/attachments/") {
+			return
 		}
-		selectionSet = append(selectionSet, n)
-		n = n.Next()
-	}
-
-	node := NewNode(html.ElementNode, data).AddAttr("class", class).AddAttr("ne-level", strconv.FormatInt(int64(level), 10))
-
-	for _, s := range selectionSet {
-		ul := s.Children().First()
-		for {
-			ul = c.mergeAdjoinNode(ul, level+1)
-			if ul == nil || len(ul.Nodes) == 0 {
-				break
-			}
+		base, err := url.Parse(c.yuqueDoc.Url())
+		if err != nil {
+			return
+		}
+		// 下载文件时携带语雀token，只下载语雀域名下的文件
+		u = base.ResolveReference(u)
+		if !c.IsFile(u) {
+			return
+		}
+		fileName, err := url.PathUnescape(path.Base(u.Path))
+		if err != nil {
+			return
+		}
+		if !rule.AllowMimeType(c.FileMimeType(fileName)) {
+			return
+		}
+		fileUrl := u.String()
+		etag, _ := yuque.FileEtag(fileUrl)
+		err = c.AddAttachment(fileName, etag, func() ([]byte, error) {
+			return yuque.DownloadFile(fileUrl, rule.MaxSize)
+		})
+		if err != nil {
+			return
 		}
 
-		node.AddChildren(BuildNodes(c.cloneNodes(s.Children().Nodes)))
-	}
-
-	selection.ReplaceWithNodes(node.Node())
+		selection.ReplaceWithNodes(c.AttachmentNode(fileName, selection.Text(), rule.Macro).Node())
+	})
+}
 
-	if len(selectionSet) > 1 {
-		for _, s := range selectionSet[1:] {
-			s.Remove()
-		}
+func (c *HtmlConverter) AttachmentNode(fileName string, text string, macro string) *Node {
+	if macro == config.AttachmentMacroViewFile {
+		return NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "view-file").
+			AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
+			NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", "name").AddChild(
+				NewNode(html.ElementNode, "ri:attachment").AddAttr("ri:filename", fileName)))
 	}
 
-	return n.Next()
+	if text == "" {
+		text = fileName
+	}
+	return NewNode(html.ElementNode, "ac:link").AddChild(
+		NewNode(html.ElementNode, "ri:attachment").AddAttr("ri:filename", fileName)).AddChild(
+		NewNode(html.ElementNode, "ac:plain-text-link-body").AddChild(
+			NewCDataNode(text)))
 }
 
 func (c *HtmlConverter) cloneNodes(nodes []*html.Node) []*html.Node {
@@ -315,53 +640,89 @@ func (c *HtmlConverter) cloneNode(node *html.Node) *html.Node {
 	return newNode
 }
 
-func (c *HtmlConverter) ConvertTodoList() {
-	taskId := 1
-	c.document.Find("ul[class=ne-tl][ne-level=\"0\"]").Each(func(i int, selection *goquery.Selection) {
-		taskId = c.ConvertTodoNodes(selection.Children().First(), taskId)
-		selection.ReplaceWithNodes(NewNode(html.ElementNode, "ac:task-list").AddChildren(
-			BuildNodes(c.cloneNodes(selection.Children().Nodes))).Node())
+func (c *HtmlConverter) ConvertTodoList(selections *goquery.Selection) {
+	usedTaskIds := make(map[int]bool)
+	// 嵌套在待办中的待办随外层一起转换，需要在修改文档前筛选
+	roots := selections.FilterFunction(func(i int, selection *goquery.Selection) bool {
+		return selection.ParentsFiltered("ul[class=ne-tl]").Length() == 0
+	})
+	roots.Each(func(i int, selection *goquery.Selection) {
+		selection.ReplaceWithNodes(c.ConvertTodoNodes(selection, usedTaskIds).Node())
 	})
 }
 
-func (c *HtmlConverter) ConvertTodoNodes(n *goquery.Selection, taskId int) int {
-	if n == nil {
-		return taskId
-	}
-	next := &goquery.Selection{}
+// ConvertTodoNodes 将待办列表转换为任务列表，列表项中嵌套的待办转换为子任务列表，普通列表保留在任务内容中
+func (c *HtmlConverter) ConvertTodoNodes(ul *goquery.Selection, usedTaskIds map[int]bool) *Node {
+	taskList := NewNode(html.ElementNode, "ac:task-list")
+	ul.ChildrenFiltered("li").Each(func(i int, li *goquery.Selection) {
+		status := "incomplete"
+		if c.IsTodoChecked(li) {
+			status = "complete"
+		}
+		taskId := c.TaskId(li, usedTaskIds)
+		// 只处理当前列表项自身的标记，嵌套待办的标记在递归转换时处理
+		li.ChildrenFiltered(".ne-tli-symbol").Remove()
+		li.ChildrenFiltered("ul[class=ne-tl]").Each(func(i int, nested *goquery.Selection) {
+			nested.ReplaceWithNodes(c.ConvertTodoNodes(nested, usedTaskIds).Node())
+		})
+
+		taskList.AddChild(
+			NewNode(html.ElementNode, "ac:task").AddChild(
+				NewNode(html.ElementNode, "ac:task-id").AddChild(
+					NewNode(html.TextNode, strconv.Itoa(taskId)))).AddChild(
+				NewNode(html.ElementNode, "ac:task-status").AddChild(
+					NewNode(html.TextNode, status))).AddChild(
+				NewNode(html.ElementNode, "ac:task-body").AddChildren(
+					BuildNodes(c.cloneNodes(li.Children().Nodes)))))
+	})
+	return taskList
+}
 
-	for {
-		if n == nil || len(n.Nodes) == 0 {
-			break
+var todoCheckedClasses = map[string]bool{
+	"checked":               true,
+	"ne-checked":            true,
+	"ne-tli-checked":        true,
+	"ne-tli-symbol-checked": true,
+}
+
+// IsTodoChecked 语雀已完成的待办在列表项或勾选图标上带有checked标记，不检查嵌套的待办
+func (c *HtmlConverter) IsTodoChecked(li *goquery.Selection) bool {
+	symbol := li.ChildrenFiltered(".ne-tli-symbol")
+	for _, selection := range []*goquery.Selection{li, symbol} {
+		class, _ := selection.Attr("class")
+		for _, cls := range strings.Fields(class) {
+			if todoCheckedClasses[cls] {
+				return true
+			}
 		}
-		next = n.Next()
-
-		if n.Is("li") {
-			n.Find("[class=ne-tli-symbol]").Each(func(i int, selection *goquery.Selection) {
-				selection.Remove()
-			})
-
-			n.ReplaceWithNodes(
-				NewNode(html.ElementNode, "ac:task").AddChild(
-					NewNode(html.ElementNode, "ac:task-id").AddChild(
-						NewNode(html.TextNode, strconv.FormatInt(int64(taskId), 10)))).AddChild(
-					NewNode(html.ElementNode, "ac:task-status").AddChild(
-						NewNode(html.TextNode, "incomplete"))).AddChild(
-					NewNode(html.ElementNode, "ac:task-body").AddChildren(
-						BuildNodes(c.cloneNodes(n.Children().Nodes)))).Node())
-			taskId++
-		} else if n.Is("ul") {
-			taskId = c.ConvertTodoNodes(n.Children().First(), taskId)
-
-			// goquery查找时需要对:进行转义，:是关键字符
-			n.Prev().Find("ac\\:task-body").AppendNodes(
-				NewNode(html.ElementNode, "ac:task-list").AddChildren(
-					BuildNodes(c.cloneNodes(n.Children().Nodes))).Node())
-			n.Remove()
+		for _, attr := range []string{"data-checked", "ne-checked"} {
+			if checked, _ := selection.Attr(attr); checked == "true" {
+				return true
+			}
 		}
+	}
+	checkbox := "input[type=checkbox][checked]"
+	return li.ChildrenFiltered(checkbox).Length() > 0 || symbol.Find(checkbox).Length() > 0
+}
 
-		n = next
+// TaskId 根据语雀列表项id生成任务id，没有id时使用列表项自身的文本，不包含嵌套列表
+func (c *HtmlConverter) TaskId(li *goquery.Selection, usedTaskIds map[int]bool) int {
+	key, _ := li.Attr("id")
+	if key == "" {
+		key = strings.TrimSpace(li.Contents().Not("ul, ol").Text())
 	}
+	return StableTaskId(key, usedTaskIds)
+}
 
+// StableTaskId 多次同步同一文档时任务id保持不变，避免Confluence任务报告中的任务反复变化，
+// 同一页面中重复时顺延
+func StableTaskId(key string, usedTaskIds map[int]bool) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	taskId := int(hash.Sum32()%1000000000) + 1
+	for usedTaskIds[taskId] {
+		taskId++
+	}
+	usedTaskIds[taskId] = true
 	return taskId
 }
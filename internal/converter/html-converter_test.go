@@ -0,0 +1,133 @@
+package converter
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"yuque-sync-confluence/config"
+	"yuque-sync-confluence/internal/yuque"
+)
+
+// go test ./internal/converter -update 重新生成golden文件
+var update = flag.Bool("update", false, "update golden files")
+
+// 宏id每次随机生成，比较前统一替换
+var macroIdPattern = regexp.MustCompile(`ac:macro-id="[^"]*"`)
+
+type fakeImageBackend struct{}
+
+func (b *fakeImageBackend) GetImage(url string) ([]byte, error) {
+	if strings.HasSuffix(url, ".svg") {
+		return []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="120" height="60"><rect width="120" height="60"></rect></svg>`), nil
+	}
+	return []byte("image:" + url), nil
+}
+
+func (b *fakeImageBackend) GetImageEtag(url string) string {
+	return "etag:" + filepath.Base(url)
+}
+
+type fakeAttachmentBackend struct {
+	files map[string][]byte
+}
+
+func (b *fakeAttachmentBackend) AddDocAttachment(fileName string, etag string, fetch func() ([]byte, error)) error {
+	body, err := fetch()
+	if err != nil {
+		return err
+	}
+	b.files[fileName] = body
+	return nil
+}
+
+func newTestHtmlConverter(t *testing.T, name string, body string) (*HtmlConverter, *fakeAttachmentBackend) {
+	yuqueDoc := &yuque.DocTree{
+		DocInfo: &yuque.DocDetail{
+			Title:     name,
+			Namespace: "group/repo",
+			Slug:      name,
+		},
+	}
+	repoConfig := &config.RepoConfig{
+		Attribution: &config.AttributionConfig{
+			Disable: true,
+		},
+	}
+	rules, err := BuildRules(repoConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewHtmlConverterWithDetail(yuqueDoc, &yuque.DocDetail{Body: body}, nil, repoConfig, rules,
+		NewLinkResolver("https://www.yuque.com", "SPACE", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attachments := &fakeAttachmentBackend{
+		files: make(map[string][]byte),
+	}
+	c.SetBackends(&fakeImageBackend{}, attachments)
+	return c, attachments
+}
+
+func TestHtmlConverterGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "html", "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures")
+	}
+
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".html")
+		t.Run(name, func(t *testing.T) {
+			body, err := ioutil.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, attachments := newTestHtmlConverter(t, name, string(body))
+			if err := c.ConvertDocument(); err != nil {
+				t.Fatal(err)
+			}
+			storage, err := c.BodyHtml()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ValidateStorage(storage); err != nil {
+				t.Errorf("invalid storage format: %v", err)
+			}
+
+			fileNames := make([]string, 0, len(attachments.files))
+			for fileName := range attachments.files {
+				fileNames = append(fileNames, fileName)
+			}
+			sort.Strings(fileNames)
+
+			// golden文件包含转换结果和上传的附件列表
+			got := macroIdPattern.ReplaceAllString(storage, `ac:macro-id="MACRO-ID"`) + "\n"
+			for _, fileName := range fileNames {
+				got += "attachment: " + fileName + "\n"
+			}
+
+			golden := filepath.Join("testdata", "html", name+".golden")
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("read golden file: %v, run with -update to create it", err)
+			}
+			if got != string(want) {
+				t.Errorf("output mismatch for %v\n--- got\n%v\n--- want\n%v", fixture, got, string(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package converter
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	DiagramPlantUml = "plantuml"
+	DiagramMermaid  = "mermaid"
+	DiagramGraphviz = "graphviz"
+	DiagramBoard    = "board"
+	DiagramMindmap  = "mindmap"
+)
+
+// 语雀绘图卡片图片地址中的路径标记
+var diagramMarkers = []struct {
+	marker string
+	kind   string
+}{
+	{"__puml", DiagramPlantUml},
+	{"__plantuml", DiagramPlantUml},
+	{"__mermaid", DiagramMermaid},
+	{"__graphviz", DiagramGraphviz},
+	{"__board", DiagramBoard},
+	{"__whiteboard", DiagramBoard},
+	{"__mindmap", DiagramMindmap},
+}
+
+// ConvertDiagram 文本绘图配置了Confluence宏时转换为宏，否则上传渲染后的图片并附带折叠的源码，画板和思维导图仅上传图片
+func (c *HtmlConverter) ConvertDiagram(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
+		src, _ := selection.Attr("src")
+		u, err := url.Parse(src)
+		if err != nil {
+			return
+		}
+		kind := c.DiagramKind(u)
+		if kind == "" {
+			return
+		}
+		source := c.DiagramSource(u)
+
+		if macro := c.repoConfig.DiagramMacros[kind]; macro != "" && source != "" {
+			selection.ReplaceWithNodes(
+				NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", macro).
+					AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
+					NewNode(html.ElementNode, "ac:plain-text-body").AddChild(
+						NewCDataNode(source))).Node())
+			return
+		}
+
+		imageUrl := *u
+		imageUrl.Fragment = ""
+		imageUrl.RawFragment = ""
+		fileName := path.Base(imageUrl.Path)
+		err = c.AddAttachment(fileName, c.GetImageEtag(imageUrl.String()), func() ([]byte, error) {
+			return c.GetImage(imageUrl.String())
+		})
+		if err != nil {
+			return
+		}
+
+		if source != "" {
+			code := c.CodeMacro(source, &CodeOptions{
+				Language: c.repoConfig.CodeLanguage(kind),
+				Title:    kind,
+				Collapse: true,
+			}).Node()
+			// 代码宏不能放在段落中，插入到图片所在段落之后
+			if p := selection.Closest("p"); p.Length() > 0 {
+				p.AfterNodes(code)
+			} else {
+				selection.AfterNodes(code)
+			}
+		}
+		selection.ReplaceWithNodes(
+			NewNode(html.ElementNode, "ac:image").AddAttr("ac:thumbnail", "true").AddChild(
+				NewNode(html.ElementNode, "ri:attachment").AddAttr("ri:filename", fileName)).Node())
+	})
+}
+
+func (c *HtmlConverter) DiagramKind(u *url.URL) string {
+	for _, m := range diagramMarkers {
+		if strings.Contains(u.Path, m.marker) {
+			return m.kind
+		}
+	}
+	return ""
+}
+
+// DiagramSource 源码保存在图片地址的 lake_card_v2 片段中，内容为转义或base64编码的卡片JSON
+func (c *HtmlConverter) DiagramSource(u *url.URL) string {
+	fragment, err := url.ParseQuery(u.EscapedFragment())
+	if err != nil {
+		return ""
+	}
+	if code := fragment.Get("code"); code != "" {
+		return code
+	}
+	value := fragment.Get("lake_card_v2")
+	if value == "" {
+		return ""
+	}
+
+	var card struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal([]byte(value), &card); err == nil {
+		return card.Code
+	}
+	if data, err := base64.StdEncoding.DecodeString(value); err == nil {
+		if err := json.Unmarshal(data, &card); err == nil {
+			return card.Code
+		}
+	}
+	return ""
+}
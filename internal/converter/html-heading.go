@@ -0,0 +1,39 @@
+package converter
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"net/url"
+	"strings"
+)
+
+// ConvertHeading Confluence根据标题文本生成锚点，与语雀标题id不一致，
+// 因此在标题中插入以语雀标题id命名的anchor宏，并将页内链接转换为指向该锚点的链接
+func (c *HtmlConverter) ConvertHeading(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
+		id, _ := selection.Attr("id")
+		if id == "" {
+			return
+		}
+		selection.PrependNodes(
+			NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "anchor").
+				AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
+				NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", "").AddChild(
+					NewNode(html.TextNode, id))).Node())
+	})
+}
+
+func (c *HtmlConverter) ConvertAnchorLink(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
+		href, _ := selection.Attr("href")
+		anchor, err := url.PathUnescape(strings.TrimPrefix(href, "#"))
+		if err != nil || anchor == "" {
+			return
+		}
+		selection.ReplaceWithNodes(
+			NewNode(html.ElementNode, "ac:link").AddAttr("ac:anchor", anchor).AddChild(
+				NewNode(html.ElementNode, "ac:plain-text-link-body").AddChild(
+					NewCDataNode(selection.Text()))).Node())
+	})
+}
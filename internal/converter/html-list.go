@@ -0,0 +1,210 @@
+package converter
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"strconv"
+	"strings"
+)
+
+// ConvertList 语雀正文中的列表是平铺的，嵌套列表以 ne-list-wrap 包裹并用 ne-level 标记层级，
+// 按层级将嵌套列表移入上一层的列表项，并合并被拆开的同类列表
+func (c *HtmlConverter) ConvertList(selections *goquery.Selection) {
+	// 先收集列表所在的容器，重建过程中列表会被移动
+	containers := make([]*html.Node, 0)
+	seen := make(map[*html.Node]bool)
+	selections.Each(func(i int, selection *goquery.Selection) {
+		parent := selection.Nodes[0].Parent
+		if parent == nil || seen[parent] {
+			return
+		}
+		seen[parent] = true
+		containers = append(containers, parent)
+	})
+
+	for _, container := range containers {
+		c.rebuildList(container)
+	}
+}
+
+// listBuilder 记录当前连续列表在各层级上的列表
+type listBuilder struct {
+	container *html.Node
+	lists     []*html.Node
+}
+
+func (c *HtmlConverter) rebuildList(container *html.Node) {
+	b := &listBuilder{
+		container: container,
+	}
+	for child := container.FirstChild; child != nil; {
+		next := child.NextSibling
+		switch {
+		case isBlankNode(child):
+		case isListWrap(child):
+			b.addWrap(child, child, 1)
+			container.RemoveChild(child)
+		case isYuqueList(child):
+			b.addList(child, child)
+		default:
+			// 列表被其他内容隔开，之后的列表重新开始
+			b.lists = nil
+		}
+		child = next
+	}
+}
+
+// addWrap 更深层级的列表外有多层 ne-list-wrap，逐层展开，depth为当前 ne-list-wrap 的层数
+func (b *listBuilder) addWrap(anchor *html.Node, wrap *html.Node, depth int) {
+	for inner := wrap.FirstChild; inner != nil; {
+		next := inner.NextSibling
+		switch {
+		case isBlankNode(inner):
+		case isListWrap(inner):
+			b.addWrap(anchor, inner, depth+1)
+		case isYuqueList(inner):
+			b.addList(anchor, inner)
+		default:
+			b.addBlock(anchor, inner, depth)
+		}
+		inner = next
+	}
+}
+
+// addList 同一层级的同类列表合并，否则作为上一层最后一个列表项的子列表，层级缺失时挂到最深的一层
+func (b *listBuilder) addList(anchor *html.Node, list *html.Node) {
+	level, _ := strconv.Atoi(nodeAttr(list, "ne-level"))
+	if level < 0 {
+		level = 0
+	}
+	if level > len(b.lists) {
+		level = len(b.lists)
+	}
+	removeAttr(list, "ne-level")
+
+	if level < len(b.lists) && canMergeList(b.lists[level], list) {
+		for li := list.FirstChild; li != nil; {
+			next := li.NextSibling
+			list.RemoveChild(li)
+			b.lists[level].AppendChild(li)
+			li = next
+		}
+		list.Parent.RemoveChild(list)
+		b.lists = b.lists[:level+1]
+		return
+	}
+
+	if level == 0 {
+		if list.Parent != b.container {
+			list.Parent.RemoveChild(list)
+			b.container.InsertBefore(list, anchor)
+		}
+		b.lists = []*html.Node{list}
+		return
+	}
+
+	list.Parent.RemoveChild(list)
+	lastListItem(b.lists[level-1]).AppendChild(list)
+	b.lists = append(b.lists[:level], list)
+}
+
+// addBlock 嵌套层级中的段落、代码块等与同一层 ne-list-wrap 中的列表一样，属于上一层的最后一个列表项，
+// 层级缺失时挂到最深的一层
+func (b *listBuilder) addBlock(anchor *html.Node, node *html.Node, depth int) {
+	node.Parent.RemoveChild(node)
+	if len(b.lists) == 0 {
+		b.container.InsertBefore(node, anchor)
+		return
+	}
+	if depth > len(b.lists) {
+		depth = len(b.lists)
+	}
+	lastListItem(b.lists[depth-1]).AppendChild(node)
+	// 之后同层级的列表在该块之后重新开始
+	b.lists = b.lists[:depth]
+}
+
+// canMergeList 类型和样式相同的列表可以合并，有序列表指定的起始编号不连续时不合并
+func canMergeList(list *html.Node, next *html.Node) bool {
+	if list.Data != next.Data || nodeAttr(list, "class") != nodeAttr(next, "class") {
+		return false
+	}
+	start := nodeAttr(next, "start")
+	if list.Data != "ol" || start == "" {
+		return true
+	}
+	return strconv.Itoa(listStart(list)+countListItems(list)) == start
+}
+
+func listStart(list *html.Node) int {
+	start, err := strconv.Atoi(nodeAttr(list, "start"))
+	if err != nil {
+		return 1
+	}
+	return start
+}
+
+func countListItems(list *html.Node) int {
+	count := 0
+	for child := list.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.Data == "li" {
+			count++
+		}
+	}
+	return count
+}
+
+// lastListItem 返回列表的最后一个列表项，列表为空时补一个
+func lastListItem(list *html.Node) *html.Node {
+	for child := list.LastChild; child != nil; child = child.PrevSibling {
+		if child.Type == html.ElementNode && child.Data == "li" {
+			return child
+		}
+	}
+	li := NewNode(html.ElementNode, "li").Node()
+	list.AppendChild(li)
+	return li
+}
+
+func isYuqueList(node *html.Node) bool {
+	if node.Type != html.ElementNode || (node.Data != "ul" && node.Data != "ol") {
+		return false
+	}
+	class := nodeAttr(node, "class")
+	return strings.HasPrefix(class, "ne-") && !isListWrap(node)
+}
+
+func isListWrap(node *html.Node) bool {
+	if node.Type != html.ElementNode || node.Data != "ul" {
+		return false
+	}
+	for _, class := range strings.Fields(nodeAttr(node, "class")) {
+		if class == "ne-list-wrap" {
+			return true
+		}
+	}
+	return false
+}
+
+func isBlankNode(node *html.Node) bool {
+	return node.Type == html.CommentNode || (node.Type == html.TextNode && strings.TrimSpace(node.Data) == "")
+}
+
+func nodeAttr(node *html.Node, key string) string {
+	for _, attr := range node.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func removeAttr(node *html.Node, key string) {
+	attrs := node.Attr[:0]
+	for _, attr := range node.Attr {
+		if attr.Key != key {
+			attrs = append(attrs, attr)
+		}
+	}
+	node.Attr = attrs
+}
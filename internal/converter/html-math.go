@@ -0,0 +1,98 @@
+package converter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"net/url"
+	"strings"
+	"yuque-sync-confluence/config"
+)
+
+// ConvertMath 语雀公式卡片渲染为公式图片，从中提取LaTeX源码后按配置转换为公式宏、PNG附件或代码块
+func (c *HtmlConverter) ConvertMath(selections *goquery.Selection) {
+	mathConfig := c.repoConfig.MathRule()
+	selections.Each(func(i int, selection *goquery.Selection) {
+		src, _ := selection.Attr("src")
+		if !c.IsMath(src) {
+			return
+		}
+		latex := c.LatexSource(selection)
+		if latex == "" {
+			return
+		}
+
+		var node *Node
+		switch mathConfig.Target {
+		case config.MathTargetMacro:
+			node = c.MathMacro(latex, mathConfig)
+		case config.MathTargetPng:
+			node = c.MathImage(latex, mathConfig)
+		}
+		if node == nil {
+			node = c.CodeMacro(latex, &CodeOptions{
+				Language: "text",
+				Title:    "LaTeX",
+			})
+		}
+		selection.ReplaceWithNodes(node.Node())
+	})
+}
+
+func (c *HtmlConverter) IsMath(src string) bool {
+	return strings.Contains(src, "__latex") || strings.Contains(src, "/gr/latex") || strings.Contains(src, "card=math")
+}
+
+func (c *HtmlConverter) LatexSource(selection *goquery.Selection) string {
+	src, _ := selection.Attr("src")
+	if u, err := url.Parse(src); err == nil {
+		// 形如 https://g.yuque.com/gr/latex?E%3Dmc%5E2#card=math&code=E%3Dmc%5E2
+		if fragment, err := url.ParseQuery(u.EscapedFragment()); err == nil && fragment.Get("code") != "" {
+			return fragment.Get("code")
+		}
+		if strings.HasSuffix(u.Path, "/gr/latex") {
+			if latex, err := url.QueryUnescape(u.RawQuery); err == nil && latex != "" {
+				return latex
+			}
+		}
+	}
+	for _, attr := range []string{"data-code", "alt"} {
+		if latex, exist := selection.Attr(attr); exist && strings.TrimSpace(latex) != "" {
+			return strings.Trim(strings.TrimSpace(latex), "$")
+		}
+	}
+	return ""
+}
+
+func (c *HtmlConverter) MathMacro(latex string, mathConfig *config.MathConfig) *Node {
+	node := NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", mathConfig.Macro).
+		AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString())
+	if mathConfig.Param != "" {
+		return node.AddChild(
+			NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", mathConfig.Param).AddChild(
+				NewNode(html.TextNode, latex)))
+	}
+	return node.AddChild(
+		NewNode(html.ElementNode, "ac:plain-text-body").AddChild(
+			NewCDataNode(latex)))
+}
+
+func (c *HtmlConverter) MathImage(latex string, mathConfig *config.MathConfig) *Node {
+	hash := sha1.Sum([]byte(latex))
+	sum := hex.EncodeToString(hash[:])
+	fileName := "latex-" + sum[:16] + ".png"
+
+	// 文件名由公式内容生成，以此作为etag，公式未变化时不再重复渲染
+	err := c.AddAttachment(fileName, sum, func() ([]byte, error) {
+		return c.GetImage(fmt.Sprintf(mathConfig.PngUrl, url.PathEscape(latex)))
+	})
+	if err != nil {
+		return nil
+	}
+
+	return NewNode(html.ElementNode, "ac:image").AddAttr("ac:alt", latex).AddChild(
+		NewNode(html.ElementNode, "ri:attachment").AddAttr("ri:filename", fileName))
+}
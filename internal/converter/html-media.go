@@ -0,0 +1,148 @@
+package converter
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"net/url"
+	"path"
+	"strings"
+	"yuque-sync-confluence/internal/yuque"
+)
+
+// ConvertMedia 语雀上传的音视频转换为附件和multimedia宏，第三方嵌入内容转换为widget宏，不支持的嵌入内容转换为带说明的链接
+func (c *HtmlConverter) ConvertMedia(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
+		src, exist := selection.Attr("src")
+		if !exist {
+			src, exist = selection.Find("source[src]").First().Attr("src")
+		}
+		if !exist {
+			return
+		}
+		u, err := url.Parse(src)
+		if err != nil {
+			return
+		}
+		if node := c.MediaAttachment(u); node != nil {
+			selection.ReplaceWithNodes(node.Node())
+			return
+		}
+		c.ReplaceEmbed(selection, u)
+	})
+}
+
+func (c *HtmlConverter) ConvertEmbed(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
+		src, _ := selection.Attr("src")
+		u, err := url.Parse(src)
+		if err != nil {
+			return
+		}
+		c.ReplaceEmbed(selection, u)
+	})
+}
+
+// ReplaceEmbed widget宏可以放在段落中，不支持的嵌入内容转换为面板宏，面板不能放在段落中
+func (c *HtmlConverter) ReplaceEmbed(selection *goquery.Selection, u *url.URL) {
+	node := c.EmbedNode(u)
+	if c.repoConfig.IsWidgetHost(u.Host) {
+		selection.ReplaceWithNodes(node.Node())
+		return
+	}
+	c.ReplaceWithBlock(selection, node.Node())
+}
+
+// ReplaceWithBlock 块级内容不能放在段落中，所在段落只有该节点时替换整个段落，否则插入到段落之后
+func (c *HtmlConverter) ReplaceWithBlock(selection *goquery.Selection, node *html.Node) {
+	p := selection.Closest("p")
+	if p.Length() == 0 {
+		selection.ReplaceWithNodes(node)
+		return
+	}
+	selection.Remove()
+	if p.Children().Length() == 0 && strings.TrimSpace(p.Text()) == "" {
+		p.ReplaceWithNodes(node)
+		return
+	}
+	p.AfterNodes(node)
+}
+
+// IsYuqueMedia 相对地址或语雀、语雀CDN域名下的音视频，下载时携带语雀token
+func (c *HtmlConverter) IsYuqueMedia(u *url.URL) bool {
+	return u.Host == "" || yuque.IsYuqueHost(u.Hostname())
+}
+
+func (c *HtmlConverter) MediaAttachment(u *url.URL) *Node {
+	if !c.IsYuqueMedia(u) {
+		return nil
+	}
+	base, err := url.Parse(c.yuqueDoc.Url())
+	if err != nil {
+		return nil
+	}
+	mediaUrl := base.ResolveReference(u).String()
+	fileName, err := url.PathUnescape(path.Base(u.Path))
+	if err != nil {
+		return nil
+	}
+
+	maxSize := c.repoConfig.AttachmentRule().MaxSize
+	etag, _ := yuque.FileEtag(mediaUrl)
+	err = c.AddAttachment(fileName, etag, func() ([]byte, error) {
+		return yuque.DownloadFile(mediaUrl, maxSize)
+	})
+	if err != nil {
+		return nil
+	}
+
+	return NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "multimedia").
+		AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
+		NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", "name").AddChild(
+			NewNode(html.ElementNode, "ri:attachment").AddAttr("ri:filename", fileName)))
+}
+
+func (c *HtmlConverter) EmbedNode(u *url.URL) *Node {
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+	if c.repoConfig.IsWidgetHost(u.Host) {
+		return NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "widget").
+			AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
+			NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", "url").AddChild(
+				NewNode(html.ElementNode, "ri:url").AddAttr("ri:value", c.WidgetUrl(u))))
+	}
+
+	return NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "panel").
+		AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
+		NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", "title").AddChild(
+			NewNode(html.TextNode, "外部嵌入内容："+u.Host))).AddChild(
+		NewNode(html.ElementNode, "ac:rich-text-body").AddChild(
+			NewNode(html.ElementNode, "p").AddChild(
+				NewNode(html.TextNode, "Confluence 不支持直接展示该内容，请访问原链接：")).AddChild(
+				NewNode(html.ElementNode, "a").AddAttr("href", u.String()).AddChild(
+					NewNode(html.TextNode, u.String())))))
+}
+
+// WidgetUrl 将播放器地址转换为widget宏可以识别的页面地址
+func (c *HtmlConverter) WidgetUrl(u *url.URL) string {
+	switch {
+	case strings.HasSuffix(u.Host, "youtube.com") && strings.HasPrefix(u.Path, "/embed/"):
+		return "https://www.youtube.com/watch?v=" + strings.TrimPrefix(u.Path, "/embed/")
+	case u.Host == "player.vimeo.com" && strings.HasPrefix(u.Path, "/video/"):
+		return "https://vimeo.com/" + strings.TrimPrefix(u.Path, "/video/")
+	case u.Host == "player.bilibili.com":
+		if bvid := u.Query().Get("bvid"); bvid != "" {
+			return "https://www.bilibili.com/video/" + bvid
+		}
+		if aid := u.Query().Get("aid"); aid != "" {
+			return "https://www.bilibili.com/video/av" + aid
+		}
+	case (u.Host == "figma.com" || strings.HasSuffix(u.Host, ".figma.com")) && strings.HasPrefix(u.Path, "/embed"):
+		// figma嵌入地址的url参数为原始文件地址
+		if fileUrl := u.Query().Get("url"); fileUrl != "" {
+			return fileUrl
+		}
+	}
+	return u.String()
+}
@@ -1,7 +1,9 @@
 package converter
 
 import (
+	"bytes"
 	"golang.org/x/net/html"
+	"strings"
 )
 
 type Node struct {
@@ -17,6 +19,11 @@ func NewNode(nodeType html.NodeType, nodeData string) *Node {
 	}
 }
 
+// NewCDataNode 内容中的 ]]> 会提前结束CDATA，需要拆分到两个CDATA中
+func NewCDataNode(text string) *Node {
+	return NewNode(html.RawNode, "<![CDATA["+strings.ReplaceAll(text, "]]>", "]]]]><![CDATA[>")+"]]>")
+}
+
 func BuildNodes(nodes []*html.Node) []*Node {
 	ns := make([]*Node, 0, len(nodes))
 	for _, node := range nodes {
@@ -47,3 +54,11 @@ func (n *Node) AddChildren(nodes []*Node) *Node {
 func (n *Node) Node() *html.Node {
 	return n.htmlNode
 }
+
+func (n *Node) Html() (string, error) {
+	var buf bytes.Buffer
+	if err := html.Render(&buf, n.htmlNode); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
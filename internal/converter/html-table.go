@@ -0,0 +1,213 @@
+package converter
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ConvertTable 将语雀表格转换为Confluence表格，保留合并单元格、列宽、表头、单元格背景色和对齐方式
+func (c *HtmlConverter) ConvertTable(selections *goquery.Selection) {
+	selections.Each(func(i int, selection *goquery.Selection) {
+		table := NewNode(html.ElementNode, "table").AddAttr("class", "wrapped")
+
+		cols := selection.ChildrenFiltered("colgroup").ChildrenFiltered("col")
+		if cols.Length() > 0 {
+			colgroup := NewNode(html.ElementNode, "colgroup")
+			cols.Each(func(i int, col *goquery.Selection) {
+				node := NewNode(html.ElementNode, "col")
+				if width := c.ColWidth(col); width > 0 {
+					node.AddAttr("style", fmt.Sprintf("width: %.1fpx;", width))
+				}
+				colgroup.AddChild(node)
+			})
+			table.AddChild(colgroup)
+		}
+
+		tbody := NewNode(html.ElementNode, "tbody")
+		// 只处理当前表格的行，嵌套表格在后续遍历中单独处理
+		selection.ChildrenFiltered("thead, tbody, tfoot").ChildrenFiltered("tr").Each(func(i int, tr *goquery.Selection) {
+			header := c.IsHeaderRow(tr, i)
+			row := NewNode(html.ElementNode, "tr")
+			tr.ChildrenFiltered("td, th").Each(func(j int, cell *goquery.Selection) {
+				row.AddChild(c.ConvertTableCell(cell, header))
+			})
+			tbody.AddChild(row)
+		})
+		table.AddChild(tbody)
+
+		// 语雀表格外层有一个用于滚动的div
+		target := selection
+		if parent := selection.Parent(); parent.Is("div") && parent.Children().Length() == 1 {
+			if class, _ := parent.Attr("class"); strings.HasPrefix(class, "ne-table") {
+				target = parent
+			}
+		}
+		target.ReplaceWithNodes(table.Node())
+	})
+}
+
+func (c *HtmlConverter) ColWidth(col *goquery.Selection) float64 {
+	width, exist := col.Attr("width")
+	if !exist {
+		style, _ := col.Attr("style")
+		width = StyleProperty(style, "width")
+	}
+	w, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(width), "px"), 64)
+	if err != nil {
+		return 0
+	}
+	return w
+}
+
+func (c *HtmlConverter) IsHeaderRow(tr *goquery.Selection, index int) bool {
+	if tr.Parent().Is("thead") {
+		return true
+	}
+	if index == 0 && c.repoConfig.TableHeaderRow {
+		return true
+	}
+	cells := tr.ChildrenFiltered("td, th")
+	return cells.Length() > 0 && cells.Length() == cells.Filter("th").Length()
+}
+
+func (c *HtmlConverter) ConvertTableCell(cell *goquery.Selection, header bool) *Node {
+	data := "td"
+	if header {
+		data = "th"
+	}
+	node := NewNode(html.ElementNode, data)
+
+	for _, attr := range []string{"rowspan", "colspan"} {
+		if val, exist := cell.Attr(attr); exist && val != "1" {
+			node.AddAttr(attr, val)
+		}
+	}
+
+	style, _ := cell.Attr("style")
+	if color := HighlightColour(StyleProperty(style, "background-color")); color != "" {
+		node.AddAttr("class", "highlight-"+color).AddAttr("data-highlight-colour", color)
+	}
+
+	// Confluence的对齐方式设置在段落上，单元格的对齐方式下放到没有设置对齐的段落
+	align := StyleProperty(style, "text-align")
+	cell.ChildrenFiltered("p").Each(func(i int, p *goquery.Selection) {
+		pStyle, _ := p.Attr("style")
+		pAlign := StyleProperty(pStyle, "text-align")
+		if pAlign == "" {
+			pAlign = align
+		}
+		if pAlign == "" || pAlign == "left" {
+			p.RemoveAttr("style")
+			return
+		}
+		p.SetAttr("style", "text-align: "+pAlign+";")
+	})
+
+	return node.AddChildren(BuildNodes(c.cloneNodes(cell.Contents().Nodes)))
+}
+
+// HighlightColour 将语雀单元格背景色按色相归入Confluence表格的高亮颜色，无法识别或接近白色时返回空
+func HighlightColour(color string) string {
+	r, g, b, ok := ParseColor(color)
+	if !ok {
+		return ""
+	}
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	lightness := (max + min) / 2
+	if max-min < 0.04 {
+		if lightness > 0.97 {
+			return ""
+		}
+		return "grey"
+	}
+
+	saturation := (max - min) / (1 - math.Abs(2*lightness-1))
+	if saturation < 0.15 {
+		return "grey"
+	}
+	var hue float64
+	switch max {
+	case r:
+		hue = math.Mod((g-b)/(max-min)+6, 6) * 60
+	case g:
+		hue = ((b-r)/(max-min) + 2) * 60
+	default:
+		hue = ((r-g)/(max-min) + 4) * 60
+	}
+	switch {
+	case hue < 20 || hue >= 300:
+		return "red"
+	case hue < 70:
+		return "yellow"
+	case hue < 170:
+		return "green"
+	default:
+		return "blue"
+	}
+}
+
+// ParseColor 解析 #rgb、#rrggbb、rgb()、rgba() 格式的颜色，返回0到1之间的分量，完全透明时视为无法识别
+func ParseColor(color string) (r float64, g float64, b float64, ok bool) {
+	color = strings.ToLower(strings.TrimSpace(color))
+	if strings.HasPrefix(color, "#") {
+		hex := color[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		if len(hex) != 6 {
+			return 0, 0, 0, false
+		}
+		value, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return 0, 0, 0, false
+		}
+		return float64(value>>16&0xff) / 255, float64(value>>8&0xff) / 255, float64(value&0xff) / 255, true
+	}
+
+	var args string
+	switch {
+	case strings.HasPrefix(color, "rgb(") && strings.HasSuffix(color, ")"):
+		args = color[len("rgb(") : len(color)-1]
+	case strings.HasPrefix(color, "rgba(") && strings.HasSuffix(color, ")"):
+		args = color[len("rgba(") : len(color)-1]
+	default:
+		return 0, 0, 0, false
+	}
+	parts := strings.Split(args, ",")
+	if len(parts) != 3 && len(parts) != 4 {
+		return 0, 0, 0, false
+	}
+	values := make([]float64, 0, 3)
+	for _, part := range parts[:3] {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || value < 0 || value > 255 {
+			return 0, 0, 0, false
+		}
+		values = append(values, value/255)
+	}
+	if len(parts) == 4 {
+		alpha, err := strconv.ParseFloat(strings.TrimSpace(parts[3]), 64)
+		if err != nil || alpha == 0 {
+			return 0, 0, 0, false
+		}
+	}
+	return values[0], values[1], values[2], true
+}
+
+func StyleProperty(style string, name string) string {
+	for _, declaration := range strings.Split(style, ";") {
+		kv := strings.SplitN(declaration, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(kv[0]), name) {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return ""
+}
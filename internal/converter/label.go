@@ -0,0 +1,48 @@
+package converter
+
+import (
+	"strings"
+	"unicode"
+	"yuque-sync-confluence/config"
+	"yuque-sync-confluence/internal/yuque"
+)
+
+// SyncLabel 所有同步页面都带有该标签
+const SyncLabel = "yuque-sync"
+
+// Confluence标签中不允许出现的字符
+const invalidLabelChars = ":;,.?&[]()#^*@!<>\"'"
+
+func NormalizeLabel(label string) string {
+	label = strings.ToLower(strings.TrimSpace(label))
+	label = strings.Join(strings.FieldsFunc(label, unicode.IsSpace), "-")
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(invalidLabelChars, r) {
+			return -1
+		}
+		return r
+	}, label)
+}
+
+// DocTags 知识库标签和文档标签
+func DocTags(yuqueDoc *yuque.DocTree, yuqueDetail *yuque.DocDetail) []string {
+	return append(append([]string{}, yuqueDoc.DocInfo.RepoTags...), yuqueDetail.Tags...)
+}
+
+func BuildLabels(tags []string, repoConfig *config.RepoConfig) []string {
+	labels := []string{SyncLabel}
+	exist := map[string]bool{SyncLabel: true}
+	for _, tag := range tags {
+		if mapped, ok := repoConfig.LabelMapping[tag]; ok {
+			tag = mapped
+		}
+		label := NormalizeLabel(tag)
+		if label == "" || exist[label] {
+			continue
+		}
+		exist[label] = true
+		labels = append(labels, label)
+	}
+
+	return labels
+}
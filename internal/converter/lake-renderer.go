@@ -0,0 +1,371 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"net/url"
+	"strconv"
+	"strings"
+	"yuque-sync-confluence/config"
+	"yuque-sync-confluence/internal/lake"
+	"yuque-sync-confluence/internal/markdown"
+	"yuque-sync-confluence/internal/yuque"
+)
+
+// LakeRenderer 将lake文档模型渲染为转换规则可以处理的html，列表和任务列表直接生成Confluence格式，
+// 卡片渲染为与语雀body_html一致的结构，由图片、公式、绘图等规则继续转换
+type LakeRenderer struct {
+	usedTaskIds map[int]bool
+}
+
+func NewLakeRenderer() *LakeRenderer {
+	return &LakeRenderer{
+		usedTaskIds: make(map[int]bool),
+	}
+}
+
+// SourceDocument 解析语雀lake正文或markdown原文，遇到无法转换的内容时返回错误，由调用方回退到body_html
+func (c *HtmlConverter) SourceDocument(converter string) (*goquery.Document, error) {
+	var document *lake.Document
+	var err error
+	switch converter {
+	case config.ConverterLake:
+		if strings.TrimSpace(c.yuqueDetail.BodyLake) == "" {
+			return nil, errors.New("empty lake body")
+		}
+		document, err = lake.Parse(c.yuqueDetail.BodyLake)
+	case config.ConverterMarkdown:
+		if c.yuqueDetail.Format != yuque.DocFormatMarkdown {
+			return nil, errors.New(fmt.Sprintf("doc format is %v", c.yuqueDetail.Format))
+		}
+		document, err = markdown.Parse(c.yuqueDetail.BodyMarkdown)
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown converter %v", converter))
+	}
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := NewLakeRenderer().RenderBlocks(document.Blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &html.Node{Type: html.DocumentNode}
+	root.AppendChild(
+		NewNode(html.ElementNode, "html").AddChild(
+			NewNode(html.ElementNode, "head")).AddChild(
+			NewNode(html.ElementNode, "body").AddChild(
+				NewNode(html.ElementNode, "div").AddAttr("class", "lake-content").AddChildren(nodes))).Node())
+
+	return goquery.NewDocumentFromNode(root), nil
+}
+
+func (r *LakeRenderer) RenderBlocks(blocks []lake.Block) ([]*Node, error) {
+	nodes := make([]*Node, 0, len(blocks))
+	for _, block := range blocks {
+		node, err := r.RenderBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func (r *LakeRenderer) RenderBlock(block lake.Block) (*Node, error) {
+	switch b := block.(type) {
+	case *lake.Paragraph:
+		node := NewNode(html.ElementNode, "p")
+		if b.Align != "" && b.Align != "left" {
+			node.AddAttr("style", "text-align: "+b.Align+";")
+		}
+		inlines, err := r.RenderInlines(b.Inlines)
+		if err != nil {
+			return nil, err
+		}
+		return node.AddChildren(inlines), nil
+	case *lake.Heading:
+		node := NewNode(html.ElementNode, "h"+strconv.Itoa(b.Level))
+		if b.Id != "" {
+			node.AddAttr("id", b.Id)
+		}
+		if b.Align != "" && b.Align != "left" {
+			node.AddAttr("style", "text-align: "+b.Align+";")
+		}
+		inlines, err := r.RenderInlines(b.Inlines)
+		if err != nil {
+			return nil, err
+		}
+		return node.AddChildren(inlines), nil
+	case *lake.List:
+		return r.RenderList(b)
+	case *lake.Blockquote:
+		children, err := r.RenderBlocks(b.Blocks)
+		if err != nil {
+			return nil, err
+		}
+		return NewNode(html.ElementNode, "blockquote").AddChildren(children), nil
+	case *lake.Alert:
+		children, err := r.RenderBlocks(b.Blocks)
+		if err != nil {
+			return nil, err
+		}
+		return NewNode(html.ElementNode, "div").AddAttr("class", "ne-alert").
+			AddAttr("data-type", b.Type).AddChildren(children), nil
+	case *lake.Table:
+		return r.RenderTable(b)
+	case *lake.Card:
+		return r.RenderCard(b)
+	}
+	return nil, errors.New(fmt.Sprintf("unsupported lake block %T", block))
+}
+
+func (r *LakeRenderer) RenderList(list *lake.List) (*Node, error) {
+	if list.Task {
+		return r.RenderTaskList(list)
+	}
+
+	data := "ul"
+	if list.Ordered {
+		data = "ol"
+	}
+	node := NewNode(html.ElementNode, data)
+	if list.Ordered && list.Start > 1 {
+		node.AddAttr("start", strconv.Itoa(list.Start))
+	}
+	for _, item := range list.Items {
+		children, err := r.RenderItemBlocks(item.Blocks)
+		if err != nil {
+			return nil, err
+		}
+		node.AddChild(NewNode(html.ElementNode, "li").AddChildren(children))
+	}
+	return node, nil
+}
+
+func (r *LakeRenderer) RenderTaskList(list *lake.List) (*Node, error) {
+	node := NewNode(html.ElementNode, "ac:task-list")
+	for _, item := range list.Items {
+		status := "incomplete"
+		if item.Checked {
+			status = "complete"
+		}
+		key := item.Id
+		if key == "" {
+			key = strings.TrimSpace(lake.PlainText(item.Blocks))
+		}
+		task := NewNode(html.ElementNode, "ac:task").AddChild(
+			NewNode(html.ElementNode, "ac:task-id").AddChild(
+				NewNode(html.TextNode, strconv.Itoa(StableTaskId(key, r.usedTaskIds))))).AddChild(
+			NewNode(html.ElementNode, "ac:task-status").AddChild(
+				NewNode(html.TextNode, status)))
+
+		children, err := r.RenderItemBlocks(item.Blocks)
+		if err != nil {
+			return nil, err
+		}
+		node.AddChild(task.AddChild(NewNode(html.ElementNode, "ac:task-body").AddChildren(children)))
+	}
+	return node, nil
+}
+
+// RenderItemBlocks 列表项的第一个段落直接输出行内内容，避免列表项中多出段落间距
+func (r *LakeRenderer) RenderItemBlocks(blocks []lake.Block) ([]*Node, error) {
+	nodes := make([]*Node, 0, len(blocks))
+	for i, block := range blocks {
+		if paragraph, ok := block.(*lake.Paragraph); ok && i == 0 {
+			inlines, err := r.RenderInlines(paragraph.Inlines)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, inlines...)
+			continue
+		}
+		node, err := r.RenderBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func (r *LakeRenderer) RenderTable(table *lake.Table) (*Node, error) {
+	node := NewNode(html.ElementNode, "table")
+	if len(table.ColWidths) > 0 {
+		colgroup := NewNode(html.ElementNode, "colgroup")
+		for _, width := range table.ColWidths {
+			col := NewNode(html.ElementNode, "col")
+			if width > 0 {
+				col.AddAttr("width", strconv.FormatFloat(width, 'f', -1, 64))
+			}
+			colgroup.AddChild(col)
+		}
+		node.AddChild(colgroup)
+	}
+
+	tbody := NewNode(html.ElementNode, "tbody")
+	for _, row := range table.Rows {
+		tr := NewNode(html.ElementNode, "tr")
+		for _, cell := range row.Cells {
+			data := "td"
+			if cell.Header {
+				data = "th"
+			}
+			td := NewNode(html.ElementNode, data)
+			if cell.RowSpan > 1 {
+				td.AddAttr("rowspan", strconv.Itoa(cell.RowSpan))
+			}
+			if cell.ColSpan > 1 {
+				td.AddAttr("colspan", strconv.Itoa(cell.ColSpan))
+			}
+			style := ""
+			if cell.Background != "" {
+				style += "background-color: " + cell.Background + ";"
+			}
+			if cell.Align != "" {
+				style += "text-align: " + cell.Align + ";"
+			}
+			if style != "" {
+				td.AddAttr("style", style)
+			}
+			children, err := r.RenderBlocks(cell.Blocks)
+			if err != nil {
+				return nil, err
+			}
+			tr.AddChild(td.AddChildren(children))
+		}
+		tbody.AddChild(tr)
+	}
+
+	return node.AddChild(tbody), nil
+}
+
+func (r *LakeRenderer) RenderInlines(inlines []lake.Inline) ([]*Node, error) {
+	nodes := make([]*Node, 0, len(inlines))
+	for _, inline := range inlines {
+		switch i := inline.(type) {
+		case *lake.Text:
+			nodes = append(nodes, r.RenderText(i))
+		case *lake.Link:
+			children, err := r.RenderInlines(i.Inlines)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, NewNode(html.ElementNode, "a").AddAttr("href", i.Href).AddChildren(children))
+		case *lake.LineBreak:
+			nodes = append(nodes, NewNode(html.ElementNode, "br"))
+		case *lake.Card:
+			node, err := r.RenderCard(i)
+			if err != nil {
+				return nil, err
+			}
+			if node != nil {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	return nodes, nil
+}
+
+func (r *LakeRenderer) RenderText(text *lake.Text) *Node {
+	node := NewNode(html.TextNode, text.Text)
+	marks := text.Marks
+	wrap := func(data string, condition bool) {
+		if condition {
+			node = NewNode(html.ElementNode, data).AddChild(node)
+		}
+	}
+	wrap("code", marks.Code)
+	wrap("sub", marks.Sub)
+	wrap("sup", marks.Sup)
+	wrap("del", marks.Strike)
+	wrap("u", marks.Underline)
+	wrap("em", marks.Italic)
+	wrap("strong", marks.Bold)
+
+	style := ""
+	if marks.Color != "" {
+		style += "color: " + marks.Color + ";"
+	}
+	if marks.Background != "" {
+		style += "background-color: " + marks.Background + ";"
+	}
+	if style != "" {
+		node = NewNode(html.ElementNode, "span").AddAttr("style", style).AddChild(node)
+	}
+	return node
+}
+
+// RenderCard 卡片渲染为语雀body_html中的对应结构，不支持的卡片返回错误
+func (r *LakeRenderer) RenderCard(card *lake.Card) (*Node, error) {
+	switch card.Name {
+	case "hr":
+		return NewNode(html.ElementNode, "hr"), nil
+	case "checkbox":
+		return nil, nil
+	case "image":
+		src := card.String("src")
+		if src == "" {
+			break
+		}
+		return NewNode(html.ElementNode, "img").AddAttr("src", src).AddAttr("alt", card.String("name")), nil
+	case "codeblock":
+		node := NewNode(html.ElementNode, "pre").AddAttr("data-language", card.String("mode"))
+		if title := card.String("name", "title"); title != "" {
+			node.AddAttr("data-title", title)
+		}
+		return node.AddChild(NewNode(html.TextNode, card.String("code"))), nil
+	case "math":
+		latex := card.String("code")
+		if latex == "" {
+			break
+		}
+		// 与body_html中的公式图片地址一致，由公式规则提取LaTeX
+		return NewNode(html.ElementNode, "img").AddAttr("src",
+			"https://g.yuque.com/gr/latex?"+url.QueryEscape(latex)+"#card=math&code="+url.QueryEscape(latex)), nil
+	case "file":
+		src := card.String("src")
+		if src == "" {
+			break
+		}
+		return NewNode(html.ElementNode, "a").AddAttr("href", src).AddChild(
+			NewNode(html.TextNode, card.String("name"))), nil
+	case "diagram", "puml", "mermaid", "graphviz", "board", "mindmap", "flowchart2":
+		src := card.String("url", "src")
+		if src == "" {
+			break
+		}
+		if code := card.String("code"); code != "" {
+			src += "#code=" + url.QueryEscape(code)
+		}
+		return NewNode(html.ElementNode, "img").AddAttr("src", src), nil
+	case "video":
+		src := card.String("src", "url")
+		if src == "" {
+			break
+		}
+		return NewNode(html.ElementNode, "video").AddAttr("src", src), nil
+	case "yuque", "bookmarklink", "bookmarkInline", "localdoc":
+		src := card.String("src", "url")
+		if src == "" {
+			break
+		}
+		title := src
+		value, _ := card.Value.(map[string]interface{})
+		if detail, ok := value["detail"].(map[string]interface{}); ok {
+			if t, ok := detail["title"].(string); ok && t != "" {
+				title = t
+			}
+		}
+		return NewNode(html.ElementNode, "a").AddAttr("href", src).AddChild(
+			NewNode(html.TextNode, title)), nil
+	}
+	return nil, errors.New(fmt.Sprintf("unsupported lake card %v", card.Name))
+}
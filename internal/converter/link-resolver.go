@@ -0,0 +1,96 @@
+package converter
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"yuque-sync-confluence/internal/yuque"
+)
+
+// LinkResolver 将语雀文档链接解析为同步后的Confluence页面
+type LinkResolver struct {
+	domain   *url.URL
+	spaceKey string
+	// key为 group/repo/slug
+	docs map[string]string
+
+	Unresolved []*UnresolvedLink
+}
+
+type UnresolvedLink struct {
+	DocTitle string
+	Url      string
+}
+
+type ResolvedLink struct {
+	Title    string
+	SpaceKey string
+	Anchor   string
+}
+
+func NewLinkResolver(domain string, spaceKey string, repos []*yuque.Repo) *LinkResolver {
+	domainUrl, err := url.Parse(domain)
+	if err != nil {
+		domainUrl = &url.URL{}
+	}
+
+	r := &LinkResolver{
+		domain:     domainUrl,
+		spaceKey:   spaceKey,
+		docs:       make(map[string]string),
+		Unresolved: make([]*UnresolvedLink, 0),
+	}
+	for _, repo := range repos {
+		r.addDocs(repo.Children)
+	}
+
+	return r
+}
+
+func (r *LinkResolver) addDocs(docs []*yuque.DocTree) {
+	for _, doc := range docs {
+		r.docs[doc.DocInfo.Namespace+"/"+doc.DocInfo.Slug] = doc.Title()
+		r.addDocs(doc.Children)
+	}
+}
+
+func (r *LinkResolver) IsYuqueLink(u *url.URL) bool {
+	if u.Host == "" {
+		return strings.HasPrefix(u.Path, "/")
+	}
+	return u.Host == r.domain.Host || u.Host == "yuque.com" || strings.HasSuffix(u.Host, ".yuque.com")
+}
+
+// Resolve 返回nil表示不是语雀文档链接或文档未同步，后者同时返回原文链接
+func (r *LinkResolver) Resolve(docTitle string, href string) (*ResolvedLink, string) {
+	u, err := url.Parse(href)
+	if err != nil || !r.IsYuqueLink(u) {
+		return nil, href
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 3 {
+		return nil, href
+	}
+
+	title, exist := r.docs[strings.Join(parts, "/")]
+	if !exist {
+		originUrl := r.domain.ResolveReference(u).String()
+		r.Unresolved = append(r.Unresolved, &UnresolvedLink{
+			DocTitle: docTitle,
+			Url:      originUrl,
+		})
+		return nil, originUrl
+	}
+
+	return &ResolvedLink{
+		Title:    title,
+		SpaceKey: r.spaceKey,
+		Anchor:   u.Fragment,
+	}, href
+}
+
+func (r *LinkResolver) Report() {
+	for _, link := range r.Unresolved {
+		log.Printf("unresolved yuque link in %v: %v", link.DocTitle, link.Url)
+	}
+}
@@ -0,0 +1,127 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"yuque-sync-confluence/config"
+	"yuque-sync-confluence/internal/confluence"
+	"yuque-sync-confluence/internal/yuque"
+)
+
+// RepoConverter 生成知识库根页面：知识库简介、首页文档内容和子页面目录
+type RepoConverter struct {
+	yuqueRepo      *yuque.Repo
+	confluenceRepo *confluence.Repo
+	repoConfig     *config.RepoConfig
+	rules          []*Rule
+	linkResolver   *LinkResolver
+}
+
+func NewRepoConverter(yuqueRepo *yuque.Repo, confluenceRepo *confluence.Repo, repoConfig *config.RepoConfig,
+	rules []*Rule, linkResolver *LinkResolver) *RepoConverter {
+	return &RepoConverter{
+		yuqueRepo:      yuqueRepo,
+		confluenceRepo: confluenceRepo,
+		repoConfig:     repoConfig,
+		rules:          rules,
+		linkResolver:   linkResolver,
+	}
+}
+
+func (c *RepoConverter) Convert() error {
+	body := NewNode(html.ElementNode, "div")
+
+	if description := c.yuqueRepo.RepoInfo.Description; description != "" {
+		body.AddChild(
+			NewNode(html.ElementNode, "p").AddChild(
+				NewNode(html.TextNode, description)))
+	}
+
+	homeHtml, err := c.HomeHtml()
+	if err != nil {
+		return err
+	}
+	if homeHtml != "" {
+		body.AddChild(NewNode(html.RawNode, homeHtml))
+	}
+
+	if toc := c.TocMacro(); toc != nil {
+		body.AddChild(toc)
+	}
+
+	repoHtml, err := body.Html()
+	if err != nil {
+		return err
+	}
+	if err := ValidateStorage(repoHtml); err != nil {
+		return errors.New(fmt.Sprintf("repo %v: %v", c.yuqueRepo.RepoInfo.Title, err))
+	}
+	if err := c.confluenceRepo.UpdateRepo(repoHtml); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *RepoConverter) HomeDoc() *yuque.DocTree {
+	for _, slug := range c.repoConfig.HomeSlugs() {
+		if doc := c.yuqueRepo.DocBySlug(slug); doc != nil {
+			return doc
+		}
+	}
+	return nil
+}
+
+func (c *RepoConverter) HomeHtml() (string, error) {
+	homeDoc := c.HomeDoc()
+	if homeDoc == nil {
+		return "", nil
+	}
+
+	// 首页文档中的图片作为附件上传到知识库根页面
+	rootTree := &confluence.DocTree{
+		DocInfo: &confluence.DocDetail{
+			Id:        c.confluenceRepo.RepoInfo.Id,
+			Title:     c.confluenceRepo.RepoInfo.Title,
+			Version:   c.confluenceRepo.RepoInfo.Version,
+			Mtime:     c.confluenceRepo.RepoInfo.Mtime,
+			Ancestors: c.confluenceRepo.RepoInfo.Ancestors,
+		},
+	}
+	htmlConverter, err := NewHtmlConverter(homeDoc, rootTree, c.repoConfig, c.rules, c.linkResolver)
+	if err != nil {
+		return "", err
+	}
+	if err := htmlConverter.ConvertDocument(); err != nil {
+		return "", err
+	}
+	bodyHtml, err := htmlConverter.BodyHtml()
+	if err != nil {
+		return "", err
+	}
+
+	// 首页文档与普通文档一样校验，校验失败时按配置回退为纯文本
+	homeHtml, _, err := htmlConverter.ValidateOrFallback(bodyHtml)
+	return homeHtml, err
+}
+
+func (c *RepoConverter) TocMacro() *Node {
+	switch c.repoConfig.HomeToc {
+	case config.HomeTocChildren:
+		return NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "children").
+			AddAttr("ac:schema-version", "2").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
+			NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", "all").AddChild(
+				NewNode(html.TextNode, "true")))
+	case config.HomeTocPageTree:
+		return NewNode(html.ElementNode, "ac:structured-macro").AddAttr("ac:name", "pagetree").
+			AddAttr("ac:schema-version", "1").AddAttr("ac:macro-id", uuid.NewString()).AddChild(
+			NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", "root").AddChild(
+				NewNode(html.ElementNode, "ac:link").AddChild(
+					NewNode(html.ElementNode, "ri:page").AddAttr("ri:content-title", "@self")))).AddChild(
+			NewNode(html.ElementNode, "ac:parameter").AddAttr("ac:name", "expandCollapseAll").AddChild(
+				NewNode(html.TextNode, "true")))
+	}
+	return nil
+}
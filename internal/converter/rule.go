@@ -0,0 +1,187 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"regexp"
+	"yuque-sync-confluence/config"
+)
+
+// Rule 转换规则，Transform的参数为文档中匹配Selector的所有节点
+type Rule struct {
+	Name     string
+	Selector string
+	// 默认不启用，需要在知识库配置的 rules.enable 中开启
+	Disabled  bool
+	Transform func(c *HtmlConverter, selections *goquery.Selection)
+}
+
+// 内置规则，按默认执行顺序排列
+var builtinRules = []*Rule{
+	{Name: "strong-separator", Selector: "strong", Transform: (*HtmlConverter).ConvertStrongSeparator},
+	{Name: "link", Selector: "a[href]", Transform: (*HtmlConverter).ConvertLink},
+	{Name: "heading-anchor", Selector: "h1[id], h2[id], h3[id], h4[id], h5[id], h6[id]", Transform: (*HtmlConverter).ConvertHeading},
+	{Name: "anchor-link", Selector: "a[href^=\"#\"]", Transform: (*HtmlConverter).ConvertAnchorLink},
+	{Name: "code", Selector: "pre", Transform: (*HtmlConverter).ConvertCode},
+	{Name: "math", Selector: "img", Transform: (*HtmlConverter).ConvertMath},
+	{Name: "diagram", Selector: "img", Transform: (*HtmlConverter).ConvertDiagram},
+	{Name: "image", Selector: "img", Transform: (*HtmlConverter).ConvertImg},
+	{Name: "svg", Selector: "img", Transform: (*HtmlConverter).ConvertSvg},
+	{Name: "file", Selector: "a[href]", Transform: (*HtmlConverter).ConvertFile},
+	{Name: "media", Selector: "video, audio", Transform: (*HtmlConverter).ConvertMedia},
+	{Name: "embed", Selector: "iframe[src]", Transform: (*HtmlConverter).ConvertEmbed},
+	{Name: "list", Selector: "ul:not([ne-level]), ol:not([ne-level])", Transform: (*HtmlConverter).ConvertList},
+	{Name: "todo-list", Selector: "ul[class=ne-tl]", Transform: (*HtmlConverter).ConvertTodoList},
+	{Name: "table", Selector: "table", Transform: (*HtmlConverter).ConvertTable},
+	{Name: "alert", Selector: ".ne-alert", Transform: (*HtmlConverter).ConvertAlert},
+	{Name: "empty-paragraph", Selector: "p", Disabled: true, Transform: (*HtmlConverter).ConvertEmptyParagraph},
+	{Name: "first-div", Selector: "div", Transform: (*HtmlConverter).ConvertFirstDiv},
+	{Name: "attribution", Selector: "body", Transform: (*HtmlConverter).ConvertAttribution},
+}
+
+// 只作用于整个页面的规则，转换评论等片段时跳过
+var pageRules = map[string]bool{
+	"first-div":   true,
+	"attribution": true,
+}
+
+// 通过RegisterRule注册的规则，未在配置中指定顺序时在内置规则之前按注册顺序执行
+var registeredRules = make([]*Rule, 0)
+
+// RegisterRule 注册自定义规则，一般在单独文件的init函数中调用，无需修改内置规则
+func RegisterRule(rule *Rule) {
+	registeredRules = append(registeredRules, rule)
+}
+
+// BuildRules 按知识库配置生成规则执行列表，每个知识库同步时生成一次
+func BuildRules(repoConfig *config.RepoConfig) ([]*Rule, error) {
+	rulesConfig := repoConfig.Rules
+	if rulesConfig == nil {
+		rulesConfig = &config.RulesConfig{}
+	}
+
+	rules := make(map[string]*Rule)
+	order := make([]string, 0, len(builtinRules)+len(registeredRules)+len(rulesConfig.Custom))
+	addRule := func(rule *Rule) error {
+		if _, exist := rules[rule.Name]; exist {
+			return errors.New(fmt.Sprintf("duplicate rule %v", rule.Name))
+		}
+		rules[rule.Name] = rule
+		order = append(order, rule.Name)
+		return nil
+	}
+	for _, rule := range registeredRules {
+		if err := addRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	for _, customConfig := range rulesConfig.Custom {
+		rule, err := NewCustomRule(customConfig)
+		if err != nil {
+			return nil, err
+		}
+		if err := addRule(rule); err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range builtinRules {
+		if err := addRule(rule); err != nil {
+			return nil, err
+		}
+	}
+
+	// 配置的顺序优先，未列出的规则按默认顺序追加在之后
+	if len(rulesConfig.Order) > 0 {
+		listed := make(map[string]bool)
+		for _, name := range rulesConfig.Order {
+			if listed[name] {
+				return nil, errors.New(fmt.Sprintf("duplicate rule %v in order", name))
+			}
+			listed[name] = true
+		}
+		defaultOrder := order
+		order = append(make([]string, 0, len(defaultOrder)), rulesConfig.Order...)
+		for _, name := range defaultOrder {
+			if !listed[name] {
+				order = append(order, name)
+			}
+		}
+	}
+	enable := make(map[string]bool)
+	for _, name := range rulesConfig.Enable {
+		enable[name] = true
+	}
+	disable := make(map[string]bool)
+	for _, name := range rulesConfig.Disable {
+		disable[name] = true
+	}
+	for _, names := range [][]string{order, rulesConfig.Enable, rulesConfig.Disable} {
+		for _, name := range names {
+			if _, exist := rules[name]; !exist {
+				return nil, errors.New(fmt.Sprintf("unknown rule %v", name))
+			}
+		}
+	}
+
+	pipeline := make([]*Rule, 0, len(order))
+	for _, name := range order {
+		rule := rules[name]
+		if disable[name] || (rule.Disabled && !enable[name]) {
+			continue
+		}
+		pipeline = append(pipeline, rule)
+	}
+
+	return pipeline, nil
+}
+
+// NewCustomRule 根据配置生成规则，用于替换公司内部的短代码等简单场景
+func NewCustomRule(customConfig *config.CustomRuleConfig) (*Rule, error) {
+	if customConfig.Name == "" || customConfig.Selector == "" {
+		return nil, errors.New("custom rule requires name and selector")
+	}
+
+	rule := &Rule{
+		Name:     customConfig.Name,
+		Selector: customConfig.Selector,
+	}
+	switch customConfig.Action {
+	case config.CustomRuleRemove:
+		rule.Transform = func(c *HtmlConverter, selections *goquery.Selection) {
+			selections.Remove()
+		}
+	case config.CustomRuleUnwrap:
+		rule.Transform = func(c *HtmlConverter, selections *goquery.Selection) {
+			selections.Each(func(i int, selection *goquery.Selection) {
+				if selection.Contents().Length() == 0 {
+					selection.Remove()
+					return
+				}
+				selection.Contents().Unwrap()
+			})
+		}
+	case config.CustomRuleReplace:
+		rule.Transform = func(c *HtmlConverter, selections *goquery.Selection) {
+			selections.ReplaceWithHtml(customConfig.Replacement)
+		}
+	case config.CustomRuleRegexp:
+		re, err := regexp.Compile(customConfig.Pattern)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("custom rule %v pattern invalid: %v", customConfig.Name, err))
+		}
+		rule.Transform = func(c *HtmlConverter, selections *goquery.Selection) {
+			selections.Each(func(i int, selection *goquery.Selection) {
+				selectionHtml, err := selection.Html()
+				if err != nil || !re.MatchString(selectionHtml) {
+					return
+				}
+				selection.SetHtml(re.ReplaceAllString(selectionHtml, customConfig.Replacement))
+			})
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("custom rule %v action unknown: %v", customConfig.Name, customConfig.Action))
+	}
+
+	return rule, nil
+}
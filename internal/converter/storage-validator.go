@@ -0,0 +1,353 @@
+package converter
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// StorageError 存储格式校验失败的位置和附近内容，行列号从1开始
+type StorageError struct {
+	Line    int
+	Column  int
+	Snippet string
+	Message string
+}
+
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("storage format invalid at line %d column %d: %v, near %q", e.Line, e.Column, e.Message, e.Snippet)
+}
+
+// 已知的ac:和ri:元素及其允许的直接父元素，父元素为空表示不限制
+var storageElements = map[string][]string{
+	"ac:structured-macro":      nil,
+	"ac:parameter":             {"ac:structured-macro"},
+	"ac:plain-text-body":       {"ac:structured-macro"},
+	"ac:rich-text-body":        {"ac:structured-macro"},
+	"ac:link":                  nil,
+	"ac:plain-text-link-body":  {"ac:link"},
+	"ac:link-body":             {"ac:link"},
+	"ac:image":                 nil,
+	"ac:caption":               {"ac:image"},
+	"ac:task-list":             nil,
+	"ac:task":                  {"ac:task-list"},
+	"ac:task-id":               {"ac:task"},
+	"ac:task-status":           {"ac:task"},
+	"ac:task-body":             {"ac:task"},
+	"ac:emoticon":              nil,
+	"ac:placeholder":           nil,
+	"ac:inline-comment-marker": nil,
+	"ac:layout":                nil,
+	"ac:layout-section":        {"ac:layout"},
+	"ac:layout-cell":           {"ac:layout-section"},
+	"ri:attachment":            {"ac:image", "ac:link", "ac:parameter"},
+	"ri:page":                  {"ac:link", "ac:parameter", "ri:attachment"},
+	"ri:blog-post":             {"ac:link", "ac:parameter", "ri:attachment"},
+	"ri:url":                   {"ac:image", "ac:link", "ac:parameter"},
+	"ri:user":                  {"ac:link", "ac:parameter"},
+	"ri:space":                 {"ac:link", "ac:parameter"},
+	"ri:content-entity":        {"ac:link", "ac:parameter"},
+	"ri:shortcut":              {"ac:link", "ac:parameter"},
+}
+
+// 不能出现在段落中的块级元素，包括宏正文中的内容
+var blockElements = map[string]bool{
+	"p":            true,
+	"div":          true,
+	"table":        true,
+	"ul":           true,
+	"ol":           true,
+	"pre":          true,
+	"blockquote":   true,
+	"h1":           true,
+	"h2":           true,
+	"h3":           true,
+	"h4":           true,
+	"h5":           true,
+	"h6":           true,
+	"ac:task-list": true,
+	"ac:layout":    true,
+}
+
+// 只能包含指定子元素的元素，忽略空白文本
+var storageChildren = map[string][]string{
+	"ac:task-list": {"ac:task"},
+	"ac:task":      {"ac:task-id", "ac:task-status", "ac:task-body"},
+}
+
+type macroRule struct {
+	Required []string
+	Bool     []string
+	// plain 或 rich，为空时不限制
+	Body string
+}
+
+// 本工具生成的宏的参数规则，其他宏只校验结构
+var macroRules = map[string]*macroRule{
+	"code":              {Bool: []string{"linenumbers", "collapse"}, Body: "plain"},
+	"html":              {Body: "plain"},
+	"info":              {Body: "rich"},
+	"note":              {Body: "rich"},
+	"warning":           {Body: "rich"},
+	"tip":               {Body: "rich"},
+	"anchor":            {Required: []string{""}},
+	"view-file":         {Required: []string{"name"}},
+	"multimedia":        {Required: []string{"name"}},
+	"widget":            {Required: []string{"url"}},
+	"children":          {Bool: []string{"all"}},
+	"pagetree":          {Required: []string{"root"}, Bool: []string{"expandCollapseAll"}},
+	"toc":               {},
+	"easy-heading-free": {},
+}
+
+const (
+	storageRoot    = "<storage-root>"
+	storageRootEnd = "</storage-root>"
+)
+
+type storageFrame struct {
+	name   string
+	offset int64
+	text   strings.Builder
+	// ac:parameter 的参数名
+	param string
+	// ac:structured-macro 的宏名、参数和正文类型
+	macro  string
+	params map[string]string
+	body   string
+}
+
+type storageValidator struct {
+	body    string
+	decoder *xml.Decoder
+	stack   []*storageFrame
+}
+
+// ValidateStorage 校验页面内容是否为合法的Confluence存储格式：XHTML格式正确、ac:和ri:元素嵌套正确、宏参数有效
+func ValidateStorage(body string) error {
+	// 页面内容可能有多个根元素，包裹一层后再解析
+	v := &storageValidator{
+		body:  storageRoot + body + storageRootEnd,
+		stack: make([]*storageFrame, 0),
+	}
+	v.decoder = xml.NewDecoder(strings.NewReader(v.body))
+	v.decoder.Strict = true
+	v.decoder.Entity = xml.HTMLEntity
+
+	for {
+		offset := v.decoder.InputOffset()
+		token, err := v.decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var syntaxError *xml.SyntaxError
+			if errors.As(err, &syntaxError) {
+				return v.error(v.decoder.InputOffset(), syntaxError.Msg)
+			}
+			return v.error(v.decoder.InputOffset(), err.Error())
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := v.start(t, offset); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			if err := v.end(); err != nil {
+				return err
+			}
+		case xml.CharData:
+			if len(v.stack) > 0 {
+				v.stack[len(v.stack)-1].text.Write(t)
+			}
+			if err := v.charData(t, offset); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (v *storageValidator) start(t xml.StartElement, offset int64) error {
+	name := elementName(t.Name)
+	if len(v.stack) == 0 {
+		v.stack = append(v.stack, &storageFrame{
+			name:   name,
+			offset: offset,
+		})
+		return nil
+	}
+	parent := ""
+	if len(v.stack) > 1 {
+		parent = v.stack[len(v.stack)-1].name
+	}
+
+	if strings.HasPrefix(name, "ac:") || strings.HasPrefix(name, "ri:") {
+		parents, known := storageElements[name]
+		if !known {
+			return v.error(offset, fmt.Sprintf("unknown element <%v>", name))
+		}
+		if len(parents) > 0 && !contains(parents, parent) {
+			if parent == "" {
+				return v.error(offset, fmt.Sprintf("<%v> must be inside %v, got top level", name, strings.Join(parents, " or ")))
+			}
+			return v.error(offset, fmt.Sprintf("<%v> must be inside %v, got <%v>", name, strings.Join(parents, " or "), parent))
+		}
+	}
+	if children, exist := storageChildren[parent]; exist && !contains(children, name) {
+		return v.error(offset, fmt.Sprintf("<%v> can not contain <%v>", parent, name))
+	}
+	if blockElements[name] {
+		for _, frame := range v.stack[1:] {
+			if frame.name == "p" {
+				return v.error(offset, fmt.Sprintf("<%v> can not be inside <p>", name))
+			}
+		}
+	}
+	if parent == "ac:plain-text-body" || parent == "ac:plain-text-link-body" {
+		return v.error(offset, fmt.Sprintf("<%v> can only contain text, got <%v>", parent, name))
+	}
+
+	frame := &storageFrame{
+		name:   name,
+		offset: offset,
+	}
+	switch name {
+	case "ac:structured-macro":
+		frame.macro = attrValue(t, "ac:name")
+		if frame.macro == "" {
+			return v.error(offset, "macro without ac:name")
+		}
+		frame.params = make(map[string]string)
+	case "ac:parameter":
+		if !hasAttr(t, "ac:name") {
+			return v.error(offset, "parameter without ac:name")
+		}
+		frame.param = attrValue(t, "ac:name")
+	case "ac:plain-text-body", "ac:rich-text-body":
+		macro := v.stack[len(v.stack)-1]
+		if macro.body != "" {
+			return v.error(offset, "macro with more than one body")
+		}
+		macro.body = strings.TrimSuffix(strings.TrimPrefix(name, "ac:"), "-text-body")
+	}
+	v.stack = append(v.stack, frame)
+
+	return nil
+}
+
+func (v *storageValidator) end() error {
+	frame := v.stack[len(v.stack)-1]
+	v.stack = v.stack[:len(v.stack)-1]
+
+	switch frame.name {
+	case "ac:parameter":
+		macro := v.stack[len(v.stack)-1]
+		macro.params[frame.param] = strings.TrimSpace(frame.text.String())
+	case "ac:structured-macro":
+		return v.macro(frame)
+	}
+
+	return nil
+}
+
+func (v *storageValidator) macro(frame *storageFrame) error {
+	rule, exist := macroRules[frame.macro]
+	if !exist {
+		return nil
+	}
+
+	for _, param := range rule.Required {
+		if _, exist := frame.params[param]; !exist {
+			return v.error(frame.offset, fmt.Sprintf("macro %v missing parameter %q", frame.macro, param))
+		}
+	}
+	for _, param := range rule.Bool {
+		if value, exist := frame.params[param]; exist && value != "true" && value != "false" {
+			return v.error(frame.offset, fmt.Sprintf("macro %v parameter %v must be true or false, got %q", frame.macro, param, value))
+		}
+	}
+	if rule.Body != "" && frame.body != "" && frame.body != rule.Body {
+		return v.error(frame.offset, fmt.Sprintf("macro %v requires %v body, got %v", frame.macro, rule.Body, frame.body))
+	}
+
+	return nil
+}
+
+func (v *storageValidator) charData(data xml.CharData, offset int64) error {
+	if len(v.stack) == 0 || strings.TrimSpace(string(data)) == "" {
+		return nil
+	}
+	parent := v.stack[len(v.stack)-1].name
+	if _, exist := storageChildren[parent]; exist {
+		return v.error(offset, fmt.Sprintf("<%v> can not contain text", parent))
+	}
+	return nil
+}
+
+// error 将包裹后的偏移转换为原内容中的行列号，并截取附近的内容
+func (v *storageValidator) error(offset int64, message string) error {
+	pos := int(offset) - len(storageRoot)
+	body := v.body[len(storageRoot) : len(v.body)-len(storageRootEnd)]
+	if pos < 0 {
+		pos = 0
+	}
+	if pos > len(body) {
+		pos = len(body)
+	}
+
+	line := strings.Count(body[:pos], "\n") + 1
+	column := pos - strings.LastIndex(body[:pos], "\n")
+
+	start := pos - 40
+	if start < 0 {
+		start = 0
+	}
+	end := pos + 40
+	if end > len(body) {
+		end = len(body)
+	}
+
+	return &StorageError{
+		Line:    line,
+		Column:  column,
+		Snippet: strings.ToValidUTF8(body[start:end], ""),
+		Message: message,
+	}
+}
+
+func elementName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+func attrValue(t xml.StartElement, key string) string {
+	for _, attr := range t.Attr {
+		if elementName(attr.Name) == key {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func hasAttr(t xml.StartElement, key string) bool {
+	for _, attr := range t.Attr {
+		if elementName(attr.Name) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package converter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		message string
+		line    int
+		column  int
+	}{
+		{
+			name: "valid",
+			body: `<p>a&nbsp;b</p><ac:structured-macro ac:name="code" ac:schema-version="1"><ac:parameter ac:name="linenumbers">true</ac:parameter><ac:plain-text-body><![CDATA[x < 1]]></ac:plain-text-body></ac:structured-macro>` +
+				"<ac:task-list>\n<ac:task><ac:task-id>1</ac:task-id><ac:task-status>complete</ac:task-status><ac:task-body>a</ac:task-body></ac:task>\n</ac:task-list>" +
+				`<ac:image><ri:attachment ri:filename="a.png" /></ac:image>`,
+		},
+		{
+			name:    "malformed xml",
+			body:    "<p>a\n<b>b</p>",
+			message: "element <b> closed by </p>",
+			line:    2,
+			column:  9,
+		},
+		{
+			name:    "unknown element",
+			body:    `<p>a</p><ac:unknown />`,
+			message: "unknown element <ac:unknown>",
+			line:    1,
+			column:  9,
+		},
+		{
+			name:    "wrong parent",
+			body:    `<p><ac:parameter ac:name="a">b</ac:parameter></p>`,
+			message: "<ac:parameter> must be inside ac:structured-macro, got <p>",
+			line:    1,
+			column:  4,
+		},
+		{
+			name:    "task at top level",
+			body:    `<ac:task><ac:task-body>a</ac:task-body></ac:task>`,
+			message: "<ac:task> must be inside ac:task-list, got top level",
+			line:    1,
+			column:  1,
+		},
+		{
+			name:    "task list with text",
+			body:    `<ac:task-list>a</ac:task-list>`,
+			message: "<ac:task-list> can not contain text",
+			line:    1,
+			column:  15,
+		},
+		{
+			name:    "task list with other element",
+			body:    `<ac:task-list><p>a</p></ac:task-list>`,
+			message: "<ac:task-list> can not contain <p>",
+			line:    1,
+			column:  15,
+		},
+		{
+			name:    "element in plain text body",
+			body:    `<ac:structured-macro ac:name="code"><ac:plain-text-body><b>a</b></ac:plain-text-body></ac:structured-macro>`,
+			message: "<ac:plain-text-body> can only contain text, got <b>",
+			line:    1,
+			column:  57,
+		},
+		{
+			name:    "block inside paragraph",
+			body:    `<p><ac:structured-macro ac:name="panel"><ac:rich-text-body><p>a</p></ac:rich-text-body></ac:structured-macro></p>`,
+			message: "<p> can not be inside <p>",
+			line:    1,
+			column:  60,
+		},
+		{
+			name:    "macro without name",
+			body:    `<ac:structured-macro></ac:structured-macro>`,
+			message: "macro without ac:name",
+			line:    1,
+			column:  1,
+		},
+		{
+			name:    "parameter without name",
+			body:    `<ac:structured-macro ac:name="toc"><ac:parameter>a</ac:parameter></ac:structured-macro>`,
+			message: "parameter without ac:name",
+			line:    1,
+			column:  36,
+		},
+		{
+			name:    "two bodies",
+			body:    `<ac:structured-macro ac:name="info"><ac:rich-text-body /><ac:rich-text-body /></ac:structured-macro>`,
+			message: "macro with more than one body",
+			line:    1,
+			column:  58,
+		},
+		{
+			name:    "missing required parameter",
+			body:    "<p>a</p>\n<ac:structured-macro ac:name=\"view-file\"></ac:structured-macro>",
+			message: `macro view-file missing parameter "name"`,
+			line:    2,
+			column:  1,
+		},
+		{
+			name:    "bad bool parameter",
+			body:    `<ac:structured-macro ac:name="code"><ac:parameter ac:name="collapse">yes</ac:parameter></ac:structured-macro>`,
+			message: `macro code parameter collapse must be true or false, got "yes"`,
+			line:    1,
+			column:  1,
+		},
+		{
+			name:    "wrong body type",
+			body:    `<ac:structured-macro ac:name="code"><ac:rich-text-body><p>a</p></ac:rich-text-body></ac:structured-macro>`,
+			message: "macro code requires plain body, got rich",
+			line:    1,
+			column:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateStorage(tt.body)
+			if tt.message == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var storageError *StorageError
+			if !errors.As(err, &storageError) {
+				t.Fatalf("got %v, want StorageError", err)
+			}
+			if !strings.Contains(storageError.Message, tt.message) {
+				t.Errorf("message %q, want %q", storageError.Message, tt.message)
+			}
+			if storageError.Line != tt.line || storageError.Column != tt.column {
+				t.Errorf("position %d:%d, want %d:%d", storageError.Line, storageError.Column, tt.line, tt.column)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package httputil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// GetLimit 与Get相同，响应内容超过maxSize字节时返回错误，Content-Length超出时不读取内容
+func GetLimit(url string, options map[string]string, params map[string]string, maxSize int64) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range options {
+		req.Header.Set(k, v)
+	}
+	q := req.URL.Query()
+	for k, v := range params {
+		q.Add(k, v)
+	}
+	req.URL.RawQuery = q.Encode()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > maxSize {
+		return nil, errors.New(fmt.Sprintf("content length %d exceeds size limit %d", resp.ContentLength, maxSize))
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, errors.New(fmt.Sprintf("status code: %d, err msg: %s", resp.StatusCode, body))
+	}
+	if int64(len(body)) > maxSize {
+		return nil, errors.New(fmt.Sprintf("content exceeds size limit %d", maxSize))
+	}
+
+	return body, nil
+}
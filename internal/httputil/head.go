@@ -0,0 +1,32 @@
+package httputil
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+func Head(url string, options map[string]string, params map[string]string) (http.Header, error) {
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range options {
+		req.Header.Set(k, v)
+	}
+	q := req.URL.Query()
+	for k, v := range params {
+		q.Add(k, v)
+	}
+	req.URL.RawQuery = q.Encode()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, errors.New(fmt.Sprintf("status code: %d", resp.StatusCode))
+	}
+
+	return resp.Header, nil
+}
@@ -0,0 +1,192 @@
+package lake
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// Document 语雀lake格式文档，列表按缩进还原为真实的嵌套结构
+type Document struct {
+	Blocks []Block
+}
+
+type Block interface {
+	block()
+}
+
+type Inline interface {
+	inline()
+}
+
+type Paragraph struct {
+	Id      string
+	Align   string
+	Inlines []Inline
+}
+
+type Heading struct {
+	Id      string
+	Level   int
+	Align   string
+	Inlines []Inline
+}
+
+type List struct {
+	Ordered bool
+	Task    bool
+	Start   int
+	Items   []*ListItem
+}
+
+// ListItem 列表项内容，嵌套列表作为列表项的子块
+type ListItem struct {
+	Id      string
+	Checked bool
+	Blocks  []Block
+}
+
+type Blockquote struct {
+	Blocks []Block
+}
+
+// Alert 语雀提示块，Type 为 info、tips、success、warning、danger 等
+type Alert struct {
+	Type   string
+	Blocks []Block
+}
+
+type Table struct {
+	ColWidths []float64
+	Rows      []*TableRow
+}
+
+type TableRow struct {
+	Cells []*TableCell
+}
+
+type TableCell struct {
+	Header     bool
+	RowSpan    int
+	ColSpan    int
+	Align      string
+	Background string
+	Blocks     []Block
+}
+
+// Card 语雀卡片，如图片、代码块、公式、文件、绘图等，Value 为卡片数据
+type Card struct {
+	Name   string
+	Inline bool
+	Value  interface{}
+}
+
+type Text struct {
+	Text  string
+	Marks Marks
+}
+
+type Marks struct {
+	Bold       bool
+	Italic     bool
+	Underline  bool
+	Strike     bool
+	Code       bool
+	Sup        bool
+	Sub        bool
+	Color      string
+	Background string
+}
+
+type Link struct {
+	Href    string
+	Inlines []Inline
+}
+
+type LineBreak struct{}
+
+func (*Paragraph) block()  {}
+func (*Heading) block()    {}
+func (*List) block()       {}
+func (*Blockquote) block() {}
+func (*Alert) block()      {}
+func (*Table) block()      {}
+func (*Card) block()       {}
+
+func (*Card) inline()      {}
+func (*Text) inline()      {}
+func (*Link) inline()      {}
+func (*LineBreak) inline() {}
+
+// String 读取卡片数据中的字符串字段，多个key时依次查找
+func (c *Card) String(keys ...string) string {
+	value, ok := c.Value.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	for _, key := range keys {
+		if s, ok := value[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func (c *Card) Bool() bool {
+	switch value := c.Value.(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+	return false
+}
+
+// PlainText 块中的纯文本，用于没有id时生成稳定的标识
+func PlainText(blocks []Block) string {
+	var builder strings.Builder
+	var inlineText func(inlines []Inline)
+	inlineText = func(inlines []Inline) {
+		for _, inline := range inlines {
+			switch i := inline.(type) {
+			case *Text:
+				builder.WriteString(i.Text)
+			case *Link:
+				inlineText(i.Inlines)
+			}
+		}
+	}
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case *Paragraph:
+			inlineText(b.Inlines)
+		case *Heading:
+			inlineText(b.Inlines)
+		case *List:
+			for _, item := range b.Items {
+				builder.WriteString(PlainText(item.Blocks))
+			}
+		case *Blockquote:
+			builder.WriteString(PlainText(b.Blocks))
+		case *Alert:
+			builder.WriteString(PlainText(b.Blocks))
+		}
+	}
+	return builder.String()
+}
+
+// decodeCardValue 卡片数据格式为 data: 加上URL编码的JSON，旧版本卡片直接保存字符串
+func decodeCardValue(raw string) interface{} {
+	if !strings.HasPrefix(raw, "data:") {
+		return raw
+	}
+	data, err := url.PathUnescape(strings.TrimPrefix(raw, "data:"))
+	if err != nil {
+		return raw
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return raw
+	}
+	return value
+}
@@ -0,0 +1,479 @@
+package lake
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strconv"
+	"strings"
+)
+
+// Parse 解析语雀lake格式正文，lake中的列表是带缩进属性的平铺列表，解析时还原为嵌套列表
+func Parse(body string) (*Document, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(body), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := parseBlocks(nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Document{
+		Blocks: blocks,
+	}, nil
+}
+
+// blockParser 记录当前连续列表在各缩进层级上的列表，用于拼接平铺的列表
+type blockParser struct {
+	blocks  []Block
+	inlines []Inline
+	lists   []*List
+}
+
+func parseBlocks(nodes []*html.Node) ([]Block, error) {
+	p := &blockParser{
+		blocks: make([]Block, 0),
+	}
+	for _, node := range nodes {
+		if err := p.parseNode(node); err != nil {
+			return nil, err
+		}
+	}
+	p.flush()
+
+	return p.blocks, nil
+}
+
+func (p *blockParser) parseNode(node *html.Node) error {
+	if node.Type == html.TextNode {
+		if len(p.inlines) == 0 && strings.TrimSpace(node.Data) == "" {
+			return nil
+		}
+		p.inlines = append(p.inlines, parseInlines([]*html.Node{node}, Marks{})...)
+		return nil
+	}
+	if node.Type != html.ElementNode {
+		return nil
+	}
+
+	switch node.Data {
+	case "meta", "style", "script", "title":
+		return nil
+	case "p":
+		p.addIndentBlock(node, &Paragraph{
+			Id:      attr(node, "id"),
+			Align:   styleProperty(attr(node, "style"), "text-align"),
+			Inlines: parseInlines(children(node), Marks{}),
+		})
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(node.Data[1:])
+		p.addBlock(&Heading{
+			Id:      attr(node, "id"),
+			Level:   level,
+			Align:   styleProperty(attr(node, "style"), "text-align"),
+			Inlines: parseInlines(children(node), Marks{}),
+		})
+	case "ul", "ol":
+		return p.addList(node)
+	case "blockquote", "div":
+		blocks, err := parseBlocks(children(node))
+		if err != nil {
+			return err
+		}
+		if alertType := alertType(node); alertType != "" {
+			p.addBlock(&Alert{
+				Type:   alertType,
+				Blocks: blocks,
+			})
+		} else if node.Data == "blockquote" {
+			p.addBlock(&Blockquote{
+				Blocks: blocks,
+			})
+		} else {
+			for _, block := range blocks {
+				p.addBlock(block)
+			}
+		}
+	case "table":
+		table, err := parseTable(node)
+		if err != nil {
+			return err
+		}
+		p.addBlock(table)
+	case "hr":
+		p.addBlock(&Card{
+			Name: "hr",
+		})
+	case "card":
+		card := parseCard(node)
+		if card.Inline {
+			p.inlines = append(p.inlines, card)
+			return nil
+		}
+		// 旧版本表格以卡片形式保存html
+		if card.Name == "table" {
+			if tableHtml := card.String("html"); tableHtml != "" {
+				document, err := Parse(tableHtml)
+				if err != nil {
+					return err
+				}
+				for _, block := range document.Blocks {
+					p.addBlock(block)
+				}
+				return nil
+			}
+		}
+		p.addIndentBlock(node, card)
+	default:
+		p.inlines = append(p.inlines, parseInlines([]*html.Node{node}, Marks{})...)
+	}
+
+	return nil
+}
+
+func (p *blockParser) flush() {
+	if len(p.inlines) == 0 {
+		return
+	}
+	inlines := p.inlines
+	p.inlines = nil
+	p.addBlock(&Paragraph{
+		Inlines: inlines,
+	})
+}
+
+func (p *blockParser) addBlock(block Block) {
+	p.flush()
+	p.lists = nil
+	p.blocks = append(p.blocks, block)
+}
+
+// addIndentBlock 紧跟列表且带缩进的段落、卡片属于对应层级的列表项，如列表项中的代码块
+func (p *blockParser) addIndentBlock(node *html.Node, block Block) {
+	indent := nodeIndent(node)
+	if indent == 0 || len(p.lists) == 0 {
+		p.addBlock(block)
+		return
+	}
+	p.flush()
+	if indent > len(p.lists) {
+		indent = len(p.lists)
+	}
+
+	parent := p.lists[indent-1]
+	if len(parent.Items) == 0 {
+		parent.Items = append(parent.Items, &ListItem{
+			Blocks: make([]Block, 0),
+		})
+	}
+	parentItem := parent.Items[len(parent.Items)-1]
+	parentItem.Blocks = append(parentItem.Blocks, block)
+	p.lists = p.lists[:indent]
+}
+
+func (p *blockParser) addList(node *html.Node) error {
+	p.flush()
+
+	list := &List{
+		Ordered: node.Data == "ol",
+		Start:   1,
+		Items:   make([]*ListItem, 0),
+	}
+	if start, err := strconv.Atoi(attr(node, "start")); err == nil {
+		list.Start = start
+	}
+	for _, child := range children(node) {
+		if child.Type != html.ElementNode || child.Data != "li" {
+			continue
+		}
+		item, task, err := parseListItem(child)
+		if err != nil {
+			return err
+		}
+		list.Task = list.Task || task
+		list.Items = append(list.Items, item)
+	}
+	if strings.Contains(attr(node, "class"), "task") {
+		list.Task = true
+	}
+
+	indent := nodeIndent(node)
+	// 缩进超过上一层列表时挂到最深的一层，避免缺失中间层级
+	if indent > len(p.lists) {
+		indent = len(p.lists)
+	}
+
+	// 有序列表指定的起始编号与上一段列表不连续时作为新列表
+	if indent < len(p.lists) && sameKind(p.lists[indent], list) &&
+		(attr(node, "start") == "" || p.lists[indent].Start+len(p.lists[indent].Items) == list.Start) {
+		p.lists[indent].Items = append(p.lists[indent].Items, list.Items...)
+		p.lists = p.lists[:indent+1]
+		return nil
+	}
+
+	if indent == 0 {
+		p.blocks = append(p.blocks, list)
+		p.lists = []*List{list}
+		return nil
+	}
+
+	parent := p.lists[indent-1]
+	if len(parent.Items) == 0 {
+		parent.Items = append(parent.Items, &ListItem{
+			Blocks: make([]Block, 0),
+		})
+	}
+	parentItem := parent.Items[len(parent.Items)-1]
+	parentItem.Blocks = append(parentItem.Blocks, list)
+	p.lists = append(p.lists[:indent], list)
+
+	return nil
+}
+
+func nodeIndent(node *html.Node) int {
+	indent, _ := strconv.Atoi(attr(node, "data-lake-indent"))
+	if indent < 0 {
+		return 0
+	}
+	return indent
+}
+
+func sameKind(a *List, b *List) bool {
+	return a.Ordered == b.Ordered && a.Task == b.Task
+}
+
+// parseListItem 任务列表项以checkbox卡片开头，卡片数据为勾选状态
+func parseListItem(node *html.Node) (*ListItem, bool, error) {
+	item := &ListItem{
+		Id: attr(node, "id"),
+	}
+
+	task := false
+	if checkbox := findCard(node, "checkbox"); checkbox != nil {
+		task = true
+		item.Checked = parseCard(checkbox).Bool()
+		checkbox.Parent.RemoveChild(checkbox)
+	}
+	if attr(node, "data-lake-checked") != "" {
+		task = true
+		item.Checked = attr(node, "data-lake-checked") == "true"
+	}
+
+	blocks, err := parseBlocks(children(node))
+	if err != nil {
+		return nil, false, err
+	}
+	item.Blocks = blocks
+
+	return item, task, nil
+}
+
+func findCard(node *html.Node, name string) *html.Node {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode {
+			continue
+		}
+		if child.Data == "card" && attr(child, "name") == name {
+			return child
+		}
+		if found := findCard(child, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func parseTable(node *html.Node) (*Table, error) {
+	table := &Table{
+		ColWidths: make([]float64, 0),
+		Rows:      make([]*TableRow, 0),
+	}
+
+	var walk func(node *html.Node, header bool) error
+	walk = func(node *html.Node, header bool) error {
+		for _, child := range children(node) {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			switch child.Data {
+			case "colgroup":
+				for _, col := range children(child) {
+					if col.Type != html.ElementNode || col.Data != "col" {
+						continue
+					}
+					width := attr(col, "width")
+					if width == "" {
+						width = styleProperty(attr(col, "style"), "width")
+					}
+					w, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(width), "px"), 64)
+					table.ColWidths = append(table.ColWidths, w)
+				}
+			case "thead":
+				if err := walk(child, true); err != nil {
+					return err
+				}
+			case "tbody", "tfoot":
+				if err := walk(child, header); err != nil {
+					return err
+				}
+			case "tr":
+				row, err := parseTableRow(child, header)
+				if err != nil {
+					return err
+				}
+				table.Rows = append(table.Rows, row)
+			}
+		}
+		return nil
+	}
+	if err := walk(node, false); err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+func parseTableRow(node *html.Node, header bool) (*TableRow, error) {
+	row := &TableRow{
+		Cells: make([]*TableCell, 0),
+	}
+	for _, child := range children(node) {
+		if child.Type != html.ElementNode || (child.Data != "td" && child.Data != "th") {
+			continue
+		}
+		blocks, err := parseBlocks(children(child))
+		if err != nil {
+			return nil, err
+		}
+		style := attr(child, "style")
+		cell := &TableCell{
+			Header:     header || child.Data == "th",
+			RowSpan:    1,
+			ColSpan:    1,
+			Align:      styleProperty(style, "text-align"),
+			Background: styleProperty(style, "background-color"),
+			Blocks:     blocks,
+		}
+		if rowSpan, err := strconv.Atoi(attr(child, "rowspan")); err == nil && rowSpan > 0 {
+			cell.RowSpan = rowSpan
+		}
+		if colSpan, err := strconv.Atoi(attr(child, "colspan")); err == nil && colSpan > 0 {
+			cell.ColSpan = colSpan
+		}
+		row.Cells = append(row.Cells, cell)
+	}
+	return row, nil
+}
+
+func parseCard(node *html.Node) *Card {
+	return &Card{
+		Name:   attr(node, "name"),
+		Inline: attr(node, "type") == "inline",
+		Value:  decodeCardValue(attr(node, "value")),
+	}
+}
+
+func parseInlines(nodes []*html.Node, marks Marks) []Inline {
+	inlines := make([]Inline, 0)
+	for _, node := range nodes {
+		if node.Type == html.TextNode {
+			if node.Data != "" {
+				inlines = append(inlines, &Text{
+					Text:  node.Data,
+					Marks: marks,
+				})
+			}
+			continue
+		}
+		if node.Type != html.ElementNode {
+			continue
+		}
+
+		childMarks := marks
+		switch node.Data {
+		case "br":
+			inlines = append(inlines, &LineBreak{})
+			continue
+		case "card":
+			inlines = append(inlines, parseCard(node))
+			continue
+		case "a":
+			inlines = append(inlines, &Link{
+				Href:    attr(node, "href"),
+				Inlines: parseInlines(children(node), marks),
+			})
+			continue
+		case "strong", "b":
+			childMarks.Bold = true
+		case "em", "i":
+			childMarks.Italic = true
+		case "u":
+			childMarks.Underline = true
+		case "del", "s", "strike":
+			childMarks.Strike = true
+		case "code":
+			childMarks.Code = true
+		case "sup":
+			childMarks.Sup = true
+		case "sub":
+			childMarks.Sub = true
+		}
+		style := attr(node, "style")
+		if color := styleProperty(style, "color"); color != "" {
+			childMarks.Color = color
+		}
+		if background := styleProperty(style, "background-color"); background != "" {
+			childMarks.Background = background
+		}
+		inlines = append(inlines, parseInlines(children(node), childMarks)...)
+	}
+	return inlines
+}
+
+// alertType 提示块的class形如 lake-alert lake-alert-info
+func alertType(node *html.Node) string {
+	for _, cls := range strings.Fields(attr(node, "class")) {
+		if strings.HasPrefix(cls, "lake-alert-") {
+			return strings.TrimPrefix(cls, "lake-alert-")
+		}
+	}
+	if strings.Contains(" "+attr(node, "class")+" ", " lake-alert ") {
+		return "info"
+	}
+	return ""
+}
+
+func children(node *html.Node) []*html.Node {
+	nodes := make([]*html.Node, 0)
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		nodes = append(nodes, child)
+	}
+	return nodes
+}
+
+func attr(node *html.Node, key string) string {
+	for _, a := range node.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func styleProperty(style string, name string) string {
+	for _, declaration := range strings.Split(style, ";") {
+		kv := strings.SplitN(declaration, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if strings.EqualFold(strings.TrimSpace(kv[0]), name) {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,239 @@
+package lake
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// listOutline 以缩进文本描述列表结构，列表为 ul/ol[start]/task，列表项为 "- 文本"，列表项中的其他块为 "> 文本"
+func listOutline(blocks []Block, indent string) string {
+	var builder strings.Builder
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case *List:
+			kind := "ul"
+			if b.Task {
+				kind = "task"
+			} else if b.Ordered {
+				kind = "ol"
+				if b.Start != 1 {
+					kind += "[" + strconv.Itoa(b.Start) + "]"
+				}
+			}
+			builder.WriteString(indent + kind + "\n")
+			for _, item := range b.Items {
+				builder.WriteString(indent + "- ")
+				rest := item.Blocks
+				if len(rest) > 0 {
+					if p, ok := rest[0].(*Paragraph); ok {
+						builder.WriteString(PlainText([]Block{p}))
+						rest = rest[1:]
+					}
+				}
+				builder.WriteString("\n")
+				builder.WriteString(listOutline(rest, indent+"  "))
+			}
+		case *Card:
+			builder.WriteString(indent + "> card:" + b.Name + "\n")
+		default:
+			builder.WriteString(indent + "> " + PlainText([]Block{b}) + "\n")
+		}
+	}
+	return builder.String()
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "nested by indent",
+			body: `<ul><li>a</li></ul><ol data-lake-indent="1"><li>b</li></ol><ul data-lake-indent="2"><li>c</li></ul><ul><li>d</li></ul>`,
+			want: "ul\n- a\n  ol\n  - b\n    ul\n    - c\n- d\n",
+		},
+		{
+			name: "missing level attaches to deepest",
+			body: `<ul><li>a</li></ul><ul data-lake-indent="3"><li>b</li></ul>`,
+			want: "ul\n- a\n  ul\n  - b\n",
+		},
+		{
+			name: "continuous start merges",
+			body: `<ol><li>a</li><li>b</li></ol><ol start="3"><li>c</li></ol>`,
+			want: "ol\n- a\n- b\n- c\n",
+		},
+		{
+			name: "discontinuous start starts new list",
+			body: `<ol><li>a</li></ol><ol start="5"><li>b</li></ol>`,
+			want: "ol\n- a\nol[5]\n- b\n",
+		},
+		{
+			name: "list after paragraph keeps start",
+			body: `<ol><li>a</li></ol><p>text</p><ol start="2"><li>b</li></ol>`,
+			want: "ol\n- a\n> text\nol[2]\n- b\n",
+		},
+		{
+			name: "indented paragraph belongs to item",
+			body: `<ol><li>a</li></ol><p data-lake-indent="1">detail</p><ol start="2"><li>b</li></ol>`,
+			want: "ol\n- a\n  > detail\n- b\n",
+		},
+		{
+			name: "indented card belongs to nested item",
+			body: `<ul><li>a</li></ul><ul data-lake-indent="1"><li>b</li></ul><card type="block" name="codeblock" value="data:%7B%22code%22%3A%22ls%22%7D" data-lake-indent="2"></card><ul data-lake-indent="1"><li>c</li></ul>`,
+			want: "ul\n- a\n  ul\n  - b\n    > card:codeblock\n  - c\n",
+		},
+		{
+			name: "indented block after nested list closes deeper level",
+			body: `<ul><li>a</li></ul><ul data-lake-indent="1"><li>b</li></ul><p data-lake-indent="1">note</p><ul data-lake-indent="1"><li>c</li></ul>`,
+			want: "ul\n- a\n  ul\n  - b\n  > note\n  ul\n  - c\n",
+		},
+		{
+			name: "indented paragraph without list",
+			body: `<p data-lake-indent="1">text</p>`,
+			want: "> text\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := Parse(tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := listOutline(document.Blocks, ""); got != tt.want {
+				t.Errorf("got\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []Block
+	}{
+		{
+			name: "paragraph with marks",
+			body: `<p id="p1" style="text-align: center">a<strong>b<em>c</em></strong><span style="color: #f00; background-color: #ff0">d</span><code>e</code></p>`,
+			want: []Block{
+				&Paragraph{Id: "p1", Align: "center", Inlines: []Inline{
+					&Text{Text: "a"},
+					&Text{Text: "b", Marks: Marks{Bold: true}},
+					&Text{Text: "c", Marks: Marks{Bold: true, Italic: true}},
+					&Text{Text: "d", Marks: Marks{Color: "#f00", Background: "#ff0"}},
+					&Text{Text: "e", Marks: Marks{Code: true}},
+				}},
+			},
+		},
+		{
+			name: "heading link and line break",
+			body: `<h2 id="h1">title</h2><p><a href="https://example.com"><u>link</u></a><br>next</p>`,
+			want: []Block{
+				&Heading{Id: "h1", Level: 2, Inlines: []Inline{&Text{Text: "title"}}},
+				&Paragraph{Inlines: []Inline{
+					&Link{Href: "https://example.com", Inlines: []Inline{&Text{Text: "link", Marks: Marks{Underline: true}}}},
+					&LineBreak{},
+					&Text{Text: "next"},
+				}},
+			},
+		},
+		{
+			name: "block and inline cards",
+			body: `<card type="block" name="hr"></card><p><card type="inline" name="image" value="data:%7B%22src%22%3A%22a.png%22%7D"></card></p><card type="block" name="codeblock" value="data:%7B%22mode%22%3A%22go%22%2C%22code%22%3A%22x%20%3A%3D%201%22%7D"></card>`,
+			want: []Block{
+				&Card{Name: "hr", Value: ""},
+				&Paragraph{Inlines: []Inline{
+					&Card{Name: "image", Inline: true, Value: map[string]interface{}{"src": "a.png"}},
+				}},
+				&Card{Name: "codeblock", Value: map[string]interface{}{"mode": "go", "code": "x := 1"}},
+			},
+		},
+		{
+			name: "task list",
+			body: `<ul class="lake-task-list"><li><card type="inline" name="checkbox" value="true"></card>done</li><li data-lake-checked="false">todo</li></ul>`,
+			want: []Block{
+				&List{Task: true, Start: 1, Items: []*ListItem{
+					{Checked: true, Blocks: []Block{&Paragraph{Inlines: []Inline{&Text{Text: "done"}}}}},
+					{Blocks: []Block{&Paragraph{Inlines: []Inline{&Text{Text: "todo"}}}}},
+				}},
+			},
+		},
+		{
+			name: "alert and blockquote",
+			body: `<div class="lake-alert lake-alert-warning"><p>careful</p></div><blockquote><p>quote</p></blockquote>`,
+			want: []Block{
+				&Alert{Type: "warning", Blocks: []Block{&Paragraph{Inlines: []Inline{&Text{Text: "careful"}}}}},
+				&Blockquote{Blocks: []Block{&Paragraph{Inlines: []Inline{&Text{Text: "quote"}}}}},
+			},
+		},
+		{
+			name: "table",
+			body: `<table><colgroup><col width="100"><col style="width: 50px"></colgroup><thead><tr><th>h</th><th>i</th></tr></thead><tbody><tr><td colspan="2" style="text-align: right; background-color: #eee"><p>c</p></td></tr></tbody></table>`,
+			want: []Block{
+				&Table{ColWidths: []float64{100, 50}, Rows: []*TableRow{
+					{Cells: []*TableCell{
+						{Header: true, RowSpan: 1, ColSpan: 1, Blocks: []Block{&Paragraph{Inlines: []Inline{&Text{Text: "h"}}}}},
+						{Header: true, RowSpan: 1, ColSpan: 1, Blocks: []Block{&Paragraph{Inlines: []Inline{&Text{Text: "i"}}}}},
+					}},
+					{Cells: []*TableCell{
+						{RowSpan: 1, ColSpan: 2, Align: "right", Background: "#eee", Blocks: []Block{&Paragraph{Inlines: []Inline{&Text{Text: "c"}}}}},
+					}},
+				}},
+			},
+		},
+		{
+			name: "legacy table card",
+			body: `<card type="block" name="table" value="data:%7B%22html%22%3A%22%3Ctable%3E%3Ctr%3E%3Ctd%3Ex%3C%2Ftd%3E%3C%2Ftr%3E%3C%2Ftable%3E%22%7D"></card>`,
+			want: []Block{
+				&Table{ColWidths: []float64{}, Rows: []*TableRow{
+					{Cells: []*TableCell{
+						{RowSpan: 1, ColSpan: 1, Blocks: []Block{&Paragraph{Inlines: []Inline{&Text{Text: "x"}}}}},
+					}},
+				}},
+			},
+		},
+		{
+			name: "loose text becomes paragraph",
+			body: `<meta charset="utf-8">text<span>more</span><p>next</p>`,
+			want: []Block{
+				&Paragraph{Inlines: []Inline{&Text{Text: "text"}, &Text{Text: "more"}}},
+				&Paragraph{Inlines: []Inline{&Text{Text: "next"}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := Parse(tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(document.Blocks, tt.want) {
+				got, _ := json.MarshalIndent(document.Blocks, "", "  ")
+				want, _ := json.MarshalIndent(tt.want, "", "  ")
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeCardValue(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want interface{}
+	}{
+		{raw: "", want: ""},
+		{raw: "true", want: "true"},
+		{raw: "data:%7B%22a%22%3A1%7D", want: map[string]interface{}{"a": float64(1)}},
+		{raw: "data:%zz", want: "data:%zz"},
+		{raw: "data:not-json", want: "data:not-json"},
+	}
+	for _, tt := range tests {
+		if got := decodeCardValue(tt.raw); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeCardValue(%q) = %#v, want %#v", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package markdown
+
+import (
+	"bytes"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+	"regexp"
+	"strings"
+	"yuque-sync-confluence/internal/lake"
+)
+
+// 语雀导出的markdown在标题前使用 <a name="id"></a> 保留标题锚点
+var anchorPattern = regexp.MustCompile(`^<a\s+name="([^"]+)"\s*>(\s*</a>)?$`)
+
+var anchorEndPattern = regexp.MustCompile(`^</a\s*>$`)
+
+var brPattern = regexp.MustCompile(`^<br\s*/?>$`)
+
+// Parse 按GFM解析语雀markdown正文，转换为与lake相同的文档模型，复用lake的渲染
+func Parse(body string) (*lake.Document, error) {
+	source := []byte(body)
+	root := goldmark.New(goldmark.WithExtensions(extension.GFM)).Parser().Parse(text.NewReader(source))
+
+	p := &parser{
+		source: source,
+	}
+	blocks, err := p.parseBlocks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lake.Document{
+		Blocks: blocks,
+	}, nil
+}
+
+type parser struct {
+	source []byte
+	// 下一个标题使用的锚点
+	anchor string
+}
+
+func (p *parser) parseBlocks(parent ast.Node) ([]lake.Block, error) {
+	blocks := make([]lake.Block, 0)
+	for node := parent.FirstChild(); node != nil; node = node.NextSibling() {
+		switch n := node.(type) {
+		case *ast.Paragraph, *ast.TextBlock:
+			if anchor := p.anchorOf(n); anchor != "" {
+				p.anchor = anchor
+				continue
+			}
+			blocks = append(blocks, &lake.Paragraph{
+				Inlines: p.parseInlines(n, lake.Marks{}),
+			})
+		case *ast.Heading:
+			blocks = append(blocks, &lake.Heading{
+				Id:      p.headingId(n),
+				Level:   n.Level,
+				Inlines: p.parseInlines(n, lake.Marks{}),
+			})
+		case *ast.ThematicBreak:
+			blocks = append(blocks, &lake.Card{
+				Name: "hr",
+			})
+		case *ast.FencedCodeBlock:
+			blocks = append(blocks, p.codeCard(string(n.Language(p.source)), n.Lines()))
+		case *ast.CodeBlock:
+			blocks = append(blocks, p.codeCard("", n.Lines()))
+		case *ast.Blockquote:
+			children, err := p.parseBlocks(n)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, &lake.Blockquote{
+				Blocks: children,
+			})
+		case *ast.List:
+			list, err := p.parseList(n)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, list)
+		case *east.Table:
+			table, err := p.parseTable(n)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, table)
+		case *ast.HTMLBlock:
+			raw := strings.TrimSpace(string(p.lines(n.Lines())))
+			if match := anchorPattern.FindStringSubmatch(raw); match != nil {
+				p.anchor = match[1]
+				continue
+			}
+			// html块按lake格式解析，lake本身是html的子集
+			document, err := lake.Parse(raw)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, document.Blocks...)
+		}
+	}
+	return blocks, nil
+}
+
+func (p *parser) parseList(n *ast.List) (*lake.List, error) {
+	list := &lake.List{
+		Ordered: n.IsOrdered(),
+		Start:   1,
+		Items:   make([]*lake.ListItem, 0),
+	}
+	if n.IsOrdered() && n.Start > 0 {
+		list.Start = n.Start
+	}
+	for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+		listItem := &lake.ListItem{}
+		// 任务列表的勾选框是列表项第一个段落的第一个子节点
+		if first := item.FirstChild(); first != nil {
+			if checkbox, ok := first.FirstChild().(*east.TaskCheckBox); ok {
+				list.Task = true
+				listItem.Checked = checkbox.IsChecked
+				first.RemoveChild(first, checkbox)
+			}
+		}
+		blocks, err := p.parseBlocks(item)
+		if err != nil {
+			return nil, err
+		}
+		listItem.Blocks = blocks
+		list.Items = append(list.Items, listItem)
+	}
+	return list, nil
+}
+
+func (p *parser) parseTable(n *east.Table) (*lake.Table, error) {
+	table := &lake.Table{
+		ColWidths: make([]float64, 0),
+		Rows:      make([]*lake.TableRow, 0),
+	}
+	for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+		_, header := row.(*east.TableHeader)
+		tableRow := &lake.TableRow{
+			Cells: make([]*lake.TableCell, 0),
+		}
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			tableCell := &lake.TableCell{
+				Header:  header,
+				RowSpan: 1,
+				ColSpan: 1,
+				Blocks: []lake.Block{
+					&lake.Paragraph{
+						Inlines: p.parseInlines(cell, lake.Marks{}),
+					},
+				},
+			}
+			if c, ok := cell.(*east.TableCell); ok && c.Alignment != east.AlignNone {
+				tableCell.Align = c.Alignment.String()
+			}
+			tableRow.Cells = append(tableRow.Cells, tableCell)
+		}
+		table.Rows = append(table.Rows, tableRow)
+	}
+	return table, nil
+}
+
+func (p *parser) parseInlines(parent ast.Node, marks lake.Marks) []lake.Inline {
+	inlines := make([]lake.Inline, 0)
+	// 上一个节点是锚点的开始标签，紧跟的结束标签一起忽略
+	anchor := false
+	for node := parent.FirstChild(); node != nil; node = node.NextSibling() {
+		if _, ok := node.(*ast.RawHTML); !ok {
+			anchor = false
+		}
+		switch n := node.(type) {
+		case *ast.Text:
+			inlines = append(inlines, &lake.Text{
+				Text:  string(n.Segment.Value(p.source)),
+				Marks: marks,
+			})
+			if n.HardLineBreak() {
+				inlines = append(inlines, &lake.LineBreak{})
+			} else if n.SoftLineBreak() {
+				inlines = append(inlines, &lake.Text{
+					Text:  " ",
+					Marks: marks,
+				})
+			}
+		case *ast.String:
+			inlines = append(inlines, &lake.Text{
+				Text:  string(n.Value),
+				Marks: marks,
+			})
+		case *ast.CodeSpan:
+			codeMarks := marks
+			codeMarks.Code = true
+			inlines = append(inlines, &lake.Text{
+				Text:  string(n.Text(p.source)),
+				Marks: codeMarks,
+			})
+		case *ast.Emphasis:
+			emphasisMarks := marks
+			if n.Level >= 2 {
+				emphasisMarks.Bold = true
+			} else {
+				emphasisMarks.Italic = true
+			}
+			inlines = append(inlines, p.parseInlines(n, emphasisMarks)...)
+		case *east.Strikethrough:
+			strikeMarks := marks
+			strikeMarks.Strike = true
+			inlines = append(inlines, p.parseInlines(n, strikeMarks)...)
+		case *ast.Link:
+			inlines = append(inlines, &lake.Link{
+				Href:    string(n.Destination),
+				Inlines: p.parseInlines(n, marks),
+			})
+		case *ast.AutoLink:
+			href := string(n.URL(p.source))
+			if n.AutoLinkType == ast.AutoLinkEmail && !strings.HasPrefix(href, "mailto:") {
+				href = "mailto:" + href
+			}
+			inlines = append(inlines, &lake.Link{
+				Href: href,
+				Inlines: []lake.Inline{
+					&lake.Text{
+						Text:  string(n.Label(p.source)),
+						Marks: marks,
+					},
+				},
+			})
+		case *ast.Image:
+			// 图片以lake图片卡片表示，与lake正文一样由图片规则上传为附件
+			inlines = append(inlines, &lake.Card{
+				Name:   "image",
+				Inline: true,
+				Value: map[string]interface{}{
+					"src":  string(n.Destination),
+					"name": string(n.Text(p.source)),
+				},
+			})
+		case *ast.RawHTML:
+			raw := string(p.lines(n.Segments))
+			isAnchor := anchorPattern.MatchString(strings.TrimSpace(raw))
+			switch {
+			case brPattern.MatchString(strings.TrimSpace(raw)):
+				inlines = append(inlines, &lake.LineBreak{})
+			case isAnchor, anchor && anchorEndPattern.MatchString(strings.TrimSpace(raw)):
+				// 标题锚点由headingId处理
+			default:
+				// 其他行内html无法转换，作为文本保留，避免内容丢失
+				inlines = append(inlines, &lake.Text{
+					Text:  raw,
+					Marks: marks,
+				})
+			}
+			anchor = isAnchor
+			continue
+		default:
+			inlines = append(inlines, p.parseInlines(n, marks)...)
+		}
+	}
+	return inlines
+}
+
+func (p *parser) codeCard(language string, lines *text.Segments) *lake.Card {
+	return &lake.Card{
+		Name: "codeblock",
+		Value: map[string]interface{}{
+			"mode": language,
+			"code": strings.TrimSuffix(string(p.lines(lines)), "\n"),
+		},
+	}
+}
+
+// headingId 优先使用标题前的锚点，其次使用标题内的锚点
+func (p *parser) headingId(n *ast.Heading) string {
+	id := p.anchor
+	p.anchor = ""
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		raw, ok := child.(*ast.RawHTML)
+		if !ok {
+			continue
+		}
+		if match := anchorPattern.FindStringSubmatch(strings.TrimSpace(string(p.lines(raw.Segments)))); match != nil {
+			return match[1]
+		}
+	}
+	return id
+}
+
+// anchorOf 段落只有一个锚点时返回锚点名称
+func (p *parser) anchorOf(n ast.Node) string {
+	raw := bytes.Buffer{}
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		switch c := child.(type) {
+		case *ast.RawHTML:
+			raw.Write(p.lines(c.Segments))
+		case *ast.Text:
+			raw.Write(c.Segment.Value(p.source))
+		default:
+			return ""
+		}
+	}
+	if match := anchorPattern.FindStringSubmatch(strings.TrimSpace(raw.String())); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func (p *parser) lines(lines *text.Segments) []byte {
+	buf := bytes.Buffer{}
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		buf.Write(segment.Value(p.source))
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,129 @@
+package markdown
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"yuque-sync-confluence/internal/lake"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []lake.Block
+	}{
+		{
+			name: "anchor before heading",
+			body: "<a name=\"h1\"></a>\n## title\n",
+			want: []lake.Block{
+				&lake.Heading{Id: "h1", Level: 2, Inlines: []lake.Inline{&lake.Text{Text: "title"}}},
+			},
+		},
+		{
+			name: "anchor inside heading",
+			body: "## <a name=\"h2\"></a>title\n",
+			want: []lake.Block{
+				&lake.Heading{Id: "h2", Level: 2, Inlines: []lake.Inline{&lake.Text{Text: "title"}}},
+			},
+		},
+		{
+			name: "marks and links",
+			body: "a **b** *c* ~~d~~ `e` [f](https://example.com)\n",
+			want: []lake.Block{
+				&lake.Paragraph{Inlines: []lake.Inline{
+					&lake.Text{Text: "a "},
+					&lake.Text{Text: "b", Marks: lake.Marks{Bold: true}},
+					&lake.Text{Text: " "},
+					&lake.Text{Text: "c", Marks: lake.Marks{Italic: true}},
+					&lake.Text{Text: " "},
+					&lake.Text{Text: "d", Marks: lake.Marks{Strike: true}},
+					&lake.Text{Text: " "},
+					&lake.Text{Text: "e", Marks: lake.Marks{Code: true}},
+					&lake.Text{Text: " "},
+					&lake.Link{Href: "https://example.com", Inlines: []lake.Inline{&lake.Text{Text: "f"}}},
+				}},
+			},
+		},
+		{
+			name: "inline br",
+			body: "a<br/>b\n",
+			want: []lake.Block{
+				&lake.Paragraph{Inlines: []lake.Inline{
+					&lake.Text{Text: "a"},
+					&lake.LineBreak{},
+					&lake.Text{Text: "b"},
+				}},
+			},
+		},
+		{
+			name: "unknown inline html kept as text",
+			body: "a <span>b</span>\n",
+			want: []lake.Block{
+				&lake.Paragraph{Inlines: []lake.Inline{
+					&lake.Text{Text: "a "},
+					&lake.Text{Text: "<span>"},
+					&lake.Text{Text: "b"},
+					&lake.Text{Text: "</span>"},
+				}},
+			},
+		},
+		{
+			name: "ordered list with start",
+			body: "3. a\n4. b\n",
+			want: []lake.Block{
+				&lake.List{Ordered: true, Start: 3, Items: []*lake.ListItem{
+					{Blocks: []lake.Block{&lake.Paragraph{Inlines: []lake.Inline{&lake.Text{Text: "a"}}}}},
+					{Blocks: []lake.Block{&lake.Paragraph{Inlines: []lake.Inline{&lake.Text{Text: "b"}}}}},
+				}},
+			},
+		},
+		{
+			name: "task list",
+			body: "- [x] a\n- [ ] b\n",
+			want: []lake.Block{
+				&lake.List{Task: true, Start: 1, Items: []*lake.ListItem{
+					{Checked: true, Blocks: []lake.Block{&lake.Paragraph{Inlines: []lake.Inline{&lake.Text{Text: "a"}}}}},
+					{Blocks: []lake.Block{&lake.Paragraph{Inlines: []lake.Inline{&lake.Text{Text: "b"}}}}},
+				}},
+			},
+		},
+		{
+			name: "fenced code",
+			body: "```go\nx := 1\n```\n",
+			want: []lake.Block{
+				&lake.Card{Name: "codeblock", Value: map[string]interface{}{"mode": "go", "code": "x := 1"}},
+			},
+		},
+		{
+			name: "table",
+			body: "| a | b |\n| :-- | --: |\n| c | d |\n",
+			want: []lake.Block{
+				&lake.Table{ColWidths: []float64{}, Rows: []*lake.TableRow{
+					{Cells: []*lake.TableCell{
+						{Header: true, RowSpan: 1, ColSpan: 1, Align: "left", Blocks: []lake.Block{&lake.Paragraph{Inlines: []lake.Inline{&lake.Text{Text: "a"}}}}},
+						{Header: true, RowSpan: 1, ColSpan: 1, Align: "right", Blocks: []lake.Block{&lake.Paragraph{Inlines: []lake.Inline{&lake.Text{Text: "b"}}}}},
+					}},
+					{Cells: []*lake.TableCell{
+						{RowSpan: 1, ColSpan: 1, Align: "left", Blocks: []lake.Block{&lake.Paragraph{Inlines: []lake.Inline{&lake.Text{Text: "c"}}}}},
+						{RowSpan: 1, ColSpan: 1, Align: "right", Blocks: []lake.Block{&lake.Paragraph{Inlines: []lake.Inline{&lake.Text{Text: "d"}}}}},
+					}},
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document, err := Parse(tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(document.Blocks, tt.want) {
+				got, _ := json.MarshalIndent(document.Blocks, "", "  ")
+				want, _ := json.MarshalIndent(tt.want, "", "  ")
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -49,6 +49,10 @@ func (a *Api) setRepoDocs(repo *RepoBrief) error {
 	}
 
 	a.setRepoDocsAncestorAndUuid(docs, docBriefs)
+	for _, doc := range docs {
+		doc.Namespace = repo.Namespace
+		doc.RepoTags = repo.Tags
+	}
 
 	repo.Docs = docs
 	return nil
@@ -145,8 +149,14 @@ func (a *Api) getRepoList(offset uint64) ([]*RepoBrief, error) {
 
 	var respData struct {
 		Data []struct {
-			Id         int    `json:"id"`
-			Title      string `json:"name"`
+			Id          int    `json:"id"`
+			Title       string `json:"name"`
+			Namespace   string `json:"namespace"`
+			Description string `json:"description"`
+			Public      int    `json:"public"`
+			Tags        []struct {
+				Title string `json:"title"`
+			} `json:"tags"`
 			UpdateTime string `json:"updated_at"`
 		} `json:"data"`
 	}
@@ -162,10 +172,19 @@ func (a *Api) getRepoList(offset uint64) ([]*RepoBrief, error) {
 			return nil, err
 		}
 
+		tags := make([]string, 0, len(d.Tags))
+		for _, t := range d.Tags {
+			tags = append(tags, t.Title)
+		}
+
 		repos = append(repos, &RepoBrief{
-			Id:    strconv.FormatInt(int64(d.Id), 10),
-			Title: d.Title,
-			Mtime: uint64(mtime.Unix()),
+			Id:          strconv.FormatInt(int64(d.Id), 10),
+			Title:       d.Title,
+			Namespace:   d.Namespace,
+			Description: d.Description,
+			Public:      d.Public,
+			Tags:        tags,
+			Mtime:       uint64(mtime.Unix()),
 		})
 	}
 
@@ -199,9 +218,11 @@ func (a *Api) getRepoDocList(repoId string, offset uint64, limit uint64) ([]*Doc
 	options := map[string]string{
 		"X-Auth-Token": a.auth,
 	}
+	// 列表中带上文档标签，内容未变化的文档同步标签时无需获取详情
 	params := map[string]string{
-		"offset": strconv.FormatUint(offset, 10),
-		"limit":  strconv.FormatUint(limit, 10),
+		"offset":              strconv.FormatUint(offset, 10),
+		"limit":               strconv.FormatUint(limit, 10),
+		"optional_properties": "tags",
 	}
 	respBody, err := httputil.Get(url, options, params)
 	if err != nil {
@@ -212,7 +233,13 @@ func (a *Api) getRepoDocList(repoId string, offset uint64, limit uint64) ([]*Doc
 		Data []struct {
 			Id         int    `json:"id"`
 			Title      string `json:"title"`
+			Slug       string `json:"slug"`
+			Status     int    `json:"status"`
+			Public     int    `json:"public"`
 			UpdateTime string `json:"updated_at"`
+			Tags       []struct {
+				Title string `json:"title"`
+			} `json:"tags"`
 		} `json:"data"`
 	}
 
@@ -227,10 +254,19 @@ func (a *Api) getRepoDocList(repoId string, offset uint64, limit uint64) ([]*Doc
 			return nil, err
 		}
 
+		tags := make([]string, 0, len(d.Tags))
+		for _, t := range d.Tags {
+			tags = append(tags, t.Title)
+		}
+
 		docs = append(docs, &DocDetail{
 			Id:     strconv.FormatInt(int64(d.Id), 10),
 			RepoId: repoId,
 			Title:  d.Title,
+			Slug:   d.Slug,
+			Status: d.Status,
+			Public: d.Public,
+			Tags:   tags,
 			Mtime:  uint64(mtime.Unix()),
 		})
 	}
@@ -252,16 +288,270 @@ func (a *Api) getDoc(repoId string, docId string) (*DocDetail, error) {
 		Data struct {
 			Id       int    `json:"id"`
 			Title    string `json:"title"`
+			Format   string `json:"format"`
+			Body     string `json:"body"`
 			BodyHtml string `json:"body_html"`
+			BodyLake string `json:"body_lake"`
+			Creator  struct {
+				Name string `json:"name"`
+			} `json:"creator"`
+			User struct {
+				Name string `json:"name"`
+			} `json:"user"`
+			LastEditor struct {
+				Name string `json:"name"`
+			} `json:"last_editor"`
+			Tags []struct {
+				Title string `json:"title"`
+			} `json:"tags"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return nil, err
+	}
+
+	author := respData.Data.Creator.Name
+	if author == "" {
+		author = respData.Data.User.Name
+	}
+
+	tags := make([]string, 0, len(respData.Data.Tags))
+	for _, t := range respData.Data.Tags {
+		tags = append(tags, t.Title)
+	}
+
+	return &DocDetail{
+		Id:           strconv.FormatInt(int64(respData.Data.Id), 10),
+		Title:        respData.Data.Title,
+		Author:       author,
+		Editor:       respData.Data.LastEditor.Name,
+		Tags:         tags,
+		Format:       respData.Data.Format,
+		Body:         respData.Data.BodyHtml,
+		BodyLake:     respData.Data.BodyLake,
+		BodyMarkdown: respData.Data.Body,
+	}, nil
+}
+
+func (a *Api) getDocCommentsFull(docId string) ([]*CommentDetail, error) {
+	commentList := make([]*CommentDetail, 0)
+	offset := uint64(0)
+	limit := uint64(20)
+
+	for {
+		comments, err := a.getDocComments(docId, offset, limit)
+		if err != nil {
+			return nil, err
+		}
+		commentList = append(commentList, comments...)
+		offset += limit
+
+		if uint64(len(comments)) < limit {
+			break
+		}
+	}
+
+	return commentList, nil
+}
+
+func (a *Api) getDocComments(docId string, offset uint64, limit uint64) ([]*CommentDetail, error) {
+	url := a.domain + "/api/v2/comments"
+	options := map[string]string{
+		"X-Auth-Token": a.auth,
+	}
+	params := map[string]string{
+		"commentable_type": "Doc",
+		"commentable_id":   docId,
+		"offset":           strconv.FormatUint(offset, 10),
+		"limit":            strconv.FormatUint(limit, 10),
+	}
+	respBody, err := httputil.Get(url, options, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respData struct {
+		Data []struct {
+			Id         int    `json:"id"`
+			ParentId   int    `json:"parent_id"`
+			BodyHtml   string `json:"body_html"`
+			CreateTime string `json:"created_at"`
+			User       struct {
+				Name string `json:"name"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return nil, err
+	}
+
+	comments := make([]*CommentDetail, 0, len(respData.Data))
+	for _, d := range respData.Data {
+		ctime, err := time.Parse(time.RFC3339, d.CreateTime)
+		if err != nil {
+			return nil, err
+		}
+
+		parentId := ""
+		if d.ParentId != 0 {
+			parentId = strconv.FormatInt(int64(d.ParentId), 10)
+		}
+		comments = append(comments, &CommentDetail{
+			Id:       strconv.FormatInt(int64(d.Id), 10),
+			ParentId: parentId,
+			Author:   d.User.Name,
+			Body:     d.BodyHtml,
+			Ctime:    uint64(ctime.Unix()),
+		})
+	}
+
+	return comments, nil
+}
+
+func (a *Api) getDocVersions(docId string) ([]*VersionDetail, error) {
+	// 语雀仅保留最近的部分历史版本
+	url := a.domain + "/api/v2/doc_versions"
+	options := map[string]string{
+		"X-Auth-Token": a.auth,
+	}
+	params := map[string]string{
+		"doc_id": docId,
+	}
+	respBody, err := httputil.Get(url, options, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var respData struct {
+		Data []struct {
+			Id         int    `json:"id"`
+			CreateTime string `json:"created_at"`
+			UpdateTime string `json:"updated_at"`
+			User       struct {
+				Name string `json:"name"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return nil, err
+	}
+
+	versions := make([]*VersionDetail, 0, len(respData.Data))
+	for _, d := range respData.Data {
+		ctime, err := time.Parse(time.RFC3339, d.CreateTime)
+		if err != nil {
+			return nil, err
+		}
+		mtime := ctime
+		if d.UpdateTime != "" {
+			mtime, err = time.Parse(time.RFC3339, d.UpdateTime)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		versions = append(versions, &VersionDetail{
+			Id:     strconv.FormatInt(int64(d.Id), 10),
+			Author: d.User.Name,
+			Ctime:  uint64(ctime.Unix()),
+			Mtime:  uint64(mtime.Unix()),
+		})
+	}
+
+	return versions, nil
+}
+
+func (a *Api) getDocVersion(versionId string) (*DocDetail, error) {
+	url := a.domain + "/api/v2/doc_versions/" + versionId
+	options := map[string]string{
+		"X-Auth-Token": a.auth,
+	}
+	respBody, err := httputil.Get(url, options, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var respData struct {
+		Data struct {
+			DocId      int    `json:"doc_id"`
+			Title      string `json:"title"`
+			Format     string `json:"format"`
+			Body       string `json:"body"`
+			BodyHtml   string `json:"body_html"`
+			BodyLake   string `json:"body_lake"`
+			CreateTime string `json:"created_at"`
+			User       struct {
+				Name string `json:"name"`
+			} `json:"user"`
 		} `json:"data"`
 	}
 	if err := json.Unmarshal(respBody, &respData); err != nil {
 		return nil, err
 	}
+	ctime, err := time.Parse(time.RFC3339, respData.Data.CreateTime)
+	if err != nil {
+		return nil, err
+	}
 
 	return &DocDetail{
-		Id:    strconv.FormatInt(int64(respData.Data.Id), 10),
-		Title: respData.Data.Title,
-		Body:  respData.Data.BodyHtml,
+		Id:           strconv.FormatInt(int64(respData.Data.DocId), 10),
+		Title:        respData.Data.Title,
+		Author:       respData.Data.User.Name,
+		Mtime:        uint64(ctime.Unix()),
+		Format:       respData.Data.Format,
+		Body:         respData.Data.BodyHtml,
+		BodyLake:     respData.Data.BodyLake,
+		BodyMarkdown: respData.Data.Body,
 	}, nil
 }
+
+func (a *Api) getRepoMembers(repoId string) ([]*MemberDetail, error) {
+	url := a.domain + "/api/v2/repos/" + repoId + "/collaborators"
+	options := map[string]string{
+		"X-Auth-Token": a.auth,
+	}
+	respBody, err := httputil.Get(url, options, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var respData struct {
+		Data []struct {
+			Role int `json:"role"`
+			User struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &respData); err != nil {
+		return nil, err
+	}
+
+	members := make([]*MemberDetail, 0, len(respData.Data))
+	for _, d := range respData.Data {
+		members = append(members, &MemberDetail{
+			Login: d.User.Login,
+			Role:  d.Role,
+		})
+	}
+
+	return members, nil
+}
+
+func (a *Api) getFile(url string, maxSize int64) ([]byte, error) {
+	options := map[string]string{
+		"X-Auth-Token": a.auth,
+	}
+	return httputil.GetLimit(url, options, nil, maxSize)
+}
+
+func (a *Api) getFileEtag(url string) (string, error) {
+	options := map[string]string{
+		"X-Auth-Token": a.auth,
+	}
+	header, err := httputil.Head(url, options, nil)
+	if err != nil {
+		return "", err
+	}
+	return header.Get("ETag"), nil
+}
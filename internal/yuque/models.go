@@ -1,6 +1,11 @@
 package yuque
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
 	"yuque-sync-confluence/config"
 )
 
@@ -19,20 +24,58 @@ type DocTree struct {
 }
 
 type RepoBrief struct {
-	Id    string       `json:"id"`
-	Title string       `json:"title"`
-	Mtime uint64       `json:"mtime"`
-	Docs  []*DocDetail `json:"docs"`
+	Id          string       `json:"id"`
+	Title       string       `json:"title"`
+	Namespace   string       `json:"namespace"`
+	Description string       `json:"description"`
+	Public      int          `json:"public"`
+	Tags        []string     `json:"tags"`
+	Mtime       uint64       `json:"mtime"`
+	Docs        []*DocDetail `json:"docs"`
 }
 
 type DocDetail struct {
+	Id        string `json:"id"`
+	RepoId    string `json:"repo_id"`
+	Namespace string `json:"namespace"`
+	Title     string `json:"title"`
+	Slug      string `json:"slug"`
+	Status    int    `json:"status"`
+	Public    int    `json:"public"`
+	Mtime     uint64 `json:"mtime"`
+	Uuid      string `json:"uuid"`
+	Ancestor  string `json:"ancestor"`
+	Author    string `json:"author"`
+	// 最后编辑者，仅文档详情中有
+	Editor   string   `json:"editor"`
+	Tags     []string `json:"tags"`
+	RepoTags []string `json:"repo_tags"`
+	Body     string   `json:"body"`
+	// 语雀原生lake格式正文
+	BodyLake string `json:"body_lake"`
+	// 文档格式为markdown时为markdown原文
+	BodyMarkdown string `json:"body_markdown"`
+	Format       string `json:"format"`
+}
+
+type CommentDetail struct {
 	Id       string `json:"id"`
-	RepoId   string `json:"repo_id"`
-	Title    string `json:"title"`
-	Mtime    uint64 `json:"mtime"`
-	Uuid     string `json:"uuid"`
-	Ancestor string `json:"ancestor"`
+	ParentId string `json:"parent_id"`
+	Author   string `json:"author"`
 	Body     string `json:"body"`
+	Ctime    uint64 `json:"ctime"`
+}
+
+type MemberDetail struct {
+	Login string `json:"login"`
+	Role  int    `json:"role"`
+}
+
+type VersionDetail struct {
+	Id     string `json:"id"`
+	Author string `json:"author"`
+	Ctime  uint64 `json:"ctime"`
+	Mtime  uint64 `json:"mtime"`
 }
 
 type DocBrief struct {
@@ -41,6 +84,17 @@ type DocBrief struct {
 	Ancestor string `json:"ancestor"`
 }
 
+const (
+	// status 0为草稿，1为已发布
+	DocStatusDraft = 0
+	// format 为 markdown、lake 等，markdown编辑器编写的文档 body 为markdown原文
+	DocFormatMarkdown = "markdown"
+	// public 0为私密，1为公开，2为企业内公开
+	DocPublicPrivate = 0
+	// 知识库成员 role 0为管理员，1为可编辑，2为只读
+	MemberRoleReader = 2
+)
+
 var client *Api
 
 func initClient(conf *config.YuqueConfig) {
@@ -68,6 +122,52 @@ func NewSpace(conf *config.YuqueConfig) (*Space, error) {
 	}, nil
 }
 
+// 语雀及其文件CDN的域名，请求时会携带语雀token
+var yuqueHosts = []string{"yuque.com", "nlark.com"}
+
+// IsYuqueHost 是否为配置的语雀域名，或语雀、语雀CDN的域名及其子域名
+func IsYuqueHost(host string) bool {
+	host = strings.ToLower(host)
+	if client != nil {
+		if u, err := url.Parse(client.domain); err == nil && strings.ToLower(u.Host) == host {
+			return true
+		}
+	}
+	for _, h := range yuqueHosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFileUrl 文件请求携带语雀token，只允许请求语雀的域名
+func checkFileUrl(fileUrl string) error {
+	u, err := url.Parse(fileUrl)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || !IsYuqueHost(u.Host) {
+		return errors.New(fmt.Sprintf("file url %v is not a yuque url", fileUrl))
+	}
+	return nil
+}
+
+// DownloadFile 下载语雀文件，超过maxSize字节时返回错误
+func DownloadFile(fileUrl string, maxSize int64) ([]byte, error) {
+	if err := checkFileUrl(fileUrl); err != nil {
+		return nil, err
+	}
+	return client.getFile(fileUrl, maxSize)
+}
+
+func FileEtag(fileUrl string) (string, error) {
+	if err := checkFileUrl(fileUrl); err != nil {
+		return "", err
+	}
+	return client.getFileEtag(fileUrl)
+}
+
 func filterOutSyncRepos(repos []*Repo, syncRepos []string) []*Repo {
 	repoSyncMap := make(map[string]bool, 0)
 	for _, repo := range syncRepos {
@@ -111,6 +211,18 @@ func filterOutSyncDocs(docs []*DocTree, outSyncMap map[string]bool) []*DocTree {
 	return ds
 }
 
+func filterDocs(docs []*DocTree, keep func(doc *DocDetail) bool) []*DocTree {
+	ds := make([]*DocTree, 0, len(docs))
+	for _, doc := range docs {
+		if keep(doc.DocInfo) {
+			doc.Children = filterDocs(doc.Children, keep)
+			ds = append(ds, doc)
+		}
+	}
+
+	return ds
+}
+
 func BuildRepos(briefs []*RepoBrief) ([]*Repo, error) {
 	repos := make([]*Repo, 0, len(briefs))
 	for _, r := range briefs {
@@ -152,6 +264,49 @@ func ConvertDocToTree(doc *DocDetail, docs []*DocDetail) *DocTree {
 	}
 }
 
+func (r *Repo) DocBySlug(slug string) *DocTree {
+	for _, doc := range r.RepoInfo.Docs {
+		if doc.Slug == slug {
+			return &DocTree{
+				DocInfo: doc,
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Repo) FilterDocs(keep func(doc *DocDetail) bool) {
+	r.Children = filterDocs(r.Children, keep)
+
+	docs := make([]*DocDetail, 0, len(r.RepoInfo.Docs))
+	for _, doc := range r.RepoInfo.Docs {
+		if keep(doc) {
+			docs = append(docs, doc)
+		}
+	}
+	r.RepoInfo.Docs = docs
+}
+
+func (d *DocDetail) IsDraft() bool {
+	return d.Status == DocStatusDraft
+}
+
+func (d *DocDetail) IsPrivate() bool {
+	return d.Public == DocPublicPrivate
+}
+
+func (r *Repo) IsPrivate() bool {
+	return r.RepoInfo.Public == DocPublicPrivate
+}
+
+func (r *Repo) Members() ([]*MemberDetail, error) {
+	return client.getRepoMembers(r.RepoInfo.Id)
+}
+
+func (m *MemberDetail) CanEdit() bool {
+	return m.Role != MemberRoleReader
+}
+
 func (t *DocTree) ChildByIndex(num int) *DocTree {
 	if t.ChildCount() <= num {
 		return nil
@@ -179,11 +334,48 @@ func (t *DocTree) ChildCount() int {
 	return len(t.Children)
 }
 
-func (t *DocTree) DocHtml() (string, error) {
+func (t *DocTree) Url() string {
+	return client.domain + "/" + t.DocInfo.Namespace + "/" + t.DocInfo.Slug
+}
+
+func (t *DocTree) Comments() ([]*CommentDetail, error) {
+	comments, err := client.getDocCommentsFull(t.DocInfo.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按创建时间排序，保证回复在被回复的评论之后处理
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].Ctime < comments[j].Ctime
+	})
+	return comments, nil
+}
+
+func (t *DocTree) Versions() ([]*VersionDetail, error) {
+	versions, err := client.getDocVersions(t.DocInfo.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按更新时间排序，接口返回的顺序不保证
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].Mtime != versions[j].Mtime {
+			return versions[i].Mtime < versions[j].Mtime
+		}
+		return versions[i].Ctime < versions[j].Ctime
+	})
+	return versions, nil
+}
+
+func (t *DocTree) VersionDetail(versionId string) (*DocDetail, error) {
+	return client.getDocVersion(versionId)
+}
+
+func (t *DocTree) Detail() (*DocDetail, error) {
 	doc, err := client.getDoc(t.DocInfo.RepoId, t.DocInfo.Id)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return doc.Body, nil
+	return doc, nil
 }